@@ -17,158 +17,169 @@ var systemStr string
 
 type ChromeAgent struct {
 	autog.Agent
-	Cfg   *Configs
 	Rag   *autog.Rag
 	Query string
 	LastHtml string
 	LastHtmlContext string
+	// Asked to emit rows of data, see RunExtract
+	Extract  bool
 	ShowLog  func (level int, content string)
 }
 
-var chromeAgent *ChromeAgent = &ChromeAgent{}
-
-func GetChromeAgent() *ChromeAgent {
-	return chromeAgent
-}
-
 var systemPrompt *autog.PromptItem = &autog.PromptItem{
 	GetPrompt : func (query string) (role string, prompt string) {
 		return autog.ROLE_SYSTEM, systemStr
 	},
 }
 
-var longHistory *autog.PromptItem =  &autog.PromptItem{
-	GetMessages : func (query string) []autog.ChatMessage {
-		return chromeAgent.GetLongHistory()
+var summaryPrompt *autog.PromptItem =  &autog.PromptItem{
+	GetPrompt : func (query string) (role string, prompt string) {
+		return "", "用500字以内总计一下我们的历史对话！"
 	},
 }
 
-var shortHistory *autog.PromptItem =  &autog.PromptItem{
-	GetMessages : func (query string) []autog.ChatMessage {
-		cxt, cancel := context.WithCancel(context.Background())
+var summaryPrefix *autog.PromptItem =  &autog.PromptItem{
+	GetPrompt : func (query string) (role string, prompt string) {
+		return "", "我们的历史对话总结如下："
+	},
+}
 
-		sigChan := make(chan os.Signal, 1)
-		done := make(chan bool)
-	
-		signal.Notify(sigChan, syscall.SIGINT)
-	
-		go func() {
-			select {
-			case <-sigChan:
-				cancel()
-			case <-cxt.Done():
-			}
-			done <- true
-		}()
-	
-		defer func() {
-			cancel()
-			<-done
-			signal.Stop(sigChan)
-		}()
-
-		msgs := chromeAgent.GetShortHistory()
-
-		currentHtml := GetHtmlContext()
-
-		if chromeAgent.LastHtml != currentHtml {
-			// HTML太大，不能完整的送给大模型，所以这里进行RAG增强检索，因为页面会刷新，所以每次都重新间索引
-			ShowAgentLog(1, fmt.Sprintf("Indexing HTML...\n"))
-			splitter := &rag.TextSplitter{
-				ChunkSize: chromeAgent.Cfg.ChunkSize,
-				Overlap: float64(chromeAgent.Cfg.ChunkOverlap)/float64(100.0),
-				BreakStartChars: []rune { '<' },
-				BreakEndChars:   []rune { '>' },
-			}
-	
-			chromeAgent.Rag.EmbeddingCallback = func (stage autog.EmbeddingStage, texts []string, embeds []autog.Embedding, i, j int, finished, tried int, err error) bool {
-				if stage != autog.EmbeddingStageIndexing {
-					return tried < 1
-				}
-	
-				if err != nil {
-					ShowAgentLog(1, fmt.Sprintf("Embedding HTML (%d/%d) Retry...\n", len(texts), finished))
-					return tried < 1
+func (s *Session) longHistory() *autog.PromptItem {
+	return &autog.PromptItem{
+		GetMessages : func (query string) []autog.ChatMessage {
+			return s.Agent.GetLongHistory()
+		},
+	}
+}
+
+func (s *Session) shortHistory() *autog.PromptItem {
+	return &autog.PromptItem{
+		GetMessages : func (query string) []autog.ChatMessage {
+			cxt, cancel := context.WithCancel(context.Background())
+
+			sigChan := make(chan os.Signal, 1)
+			done := make(chan bool)
+		
+			signal.Notify(sigChan, syscall.SIGINT)
+		
+			go func() {
+				select {
+				case <-sigChan:
+					cancel()
+				case <-cxt.Done():
 				}
-				ShowAgentLog(1, fmt.Sprintf("Embedding HTML (%d/%d) Done!\n", len(texts), finished))
-				return false
-			}
-	
-			err := chromeAgent.Rag.Indexing(cxt, "/html", currentHtml, splitter, true)
-			if err != nil {
-				ShowAgentLog(-1, fmt.Sprintf("RAG Indexing ERROR: %s\n", err))
-				return msgs
-			}
-		}
+				done <- true
+			}()
+		
+			defer func() {
+				cancel()
+				<-done
+				signal.Stop(sigChan)
+			}()
 
-		ShowAgentLog(1, fmt.Sprintf("Retrieval HTML...\n"))
-		var scoredss []autog.ScoredChunks
-		var err error
-		scoredss, err  = chromeAgent.Rag.Retrieval(cxt, "/html", []string{query}, chromeAgent.Cfg.TopK)
-		if err != nil {
-			ShowAgentLog(-1, fmt.Sprintf("RAG Retrieval ERROR: %s\n", err))
-			chromeAgent.LastHtml = ""
-			return msgs
-		}
+			msgs := s.Agent.GetShortHistory()
 
-		content := "最新的HTML内容如下\nHTML:\n"
-		for _, scoreds := range scoredss {
-			for _, scored := range scoreds {
-				content += fmt.Sprintf("...\n%s\n...\n", scored.Chunk.GetContent())
+			content, err := s.PageContext(cxt, query)
+			if err != nil {
+				return msgs
 			}
-		}
-
-		chromeAgent.LastHtmlContext = content
-		chromeAgent.LastHtml = currentHtml
 
-		ShowAgentLog(1, fmt.Sprintf("Sending...\n"))
+			s.ShowAgentLog(1, fmt.Sprintf("Sending...\n"))
 
-		msgs = append(msgs, autog.ChatMessage{Role:autog.ROLE_USER, Content: content})
-		msgs = append(msgs, autog.ChatMessage{Role:autog.ROLE_ASSISTANT, Content: "OK"})
-		return msgs
-	},
+			msgs = append(msgs, autog.ChatMessage{Role:autog.ROLE_USER, Content: content})
+			msgs = append(msgs, autog.ChatMessage{Role:autog.ROLE_ASSISTANT, Content: "OK"})
+			return msgs
+		},
+	}
 }
 
-var summaryPrompt *autog.PromptItem =  &autog.PromptItem{
-	GetPrompt : func (query string) (role string, prompt string) {
-		return "", "用500字以内总计一下我们的历史对话！"
-	},
+func (s *Session) input() *autog.Input {
+	return &autog.Input{
+		ReadContent: func() string {
+			return "问题：" + s.Agent.Query
+		},
+	}
 }
 
-var summaryPrefix *autog.PromptItem =  &autog.PromptItem{
-	GetPrompt : func (query string) (role string, prompt string) {
-		return "", "我们的历史对话总结如下："
-	},
+func (s *Session) doaction() *autog.DoAction {
+	return &autog.DoAction {
+		Do: func (content string) (ok bool, reflection string) {
+			action := s.Action
+			if action.NeedRun(content) {
+				cok, cerr, payload := action.Check(content)
+				if cok {
+					cok, cerr = s.ChromeActionApprove(content, payload)
+				}
+				if cok {
+					cok, cerr, payload = s.ChromeActionConfirm(content, payload)
+				}
+				if cok {
+					rok, rerr := action.Run(content, payload)
+					return rok, rerr
+				} else if len(cerr) > 0 {
+					return false, cerr
+				}
+			}
+			return true, ""
+		},
+	}
 }
 
-var input *autog.Input = &autog.Input{
-	ReadContent: func() string {
-		return "问题：" + chromeAgent.Query
-	},
-}
+// RAG retrieval of the current HTML, reindex only when the page changed
+func (s *Session) RetrievalHtmlContext(cxt context.Context, query string) (string, error) {
+	currentHtml := s.Redactor.RedactHtml(s.GetHtmlContext())
 
-var output *autog.Output = &autog.Output{}
+	if s.Agent.LastHtml != currentHtml {
+		// HTML太大，不能完整的送给大模型，所以这里进行RAG增强检索，因为页面会刷新，所以每次都重新间索引
+		s.ShowAgentLog(1, fmt.Sprintf("Indexing HTML...\n"))
+		splitter := s.newSplitter()
 
+		s.Agent.Rag.EmbeddingCallback = func (stage autog.EmbeddingStage, texts []string, embeds []autog.Embedding, i, j int, finished, tried int, err error) bool {
+			if stage != autog.EmbeddingStageIndexing {
+				return tried < 1
+			}
 
-var doaction *autog.DoAction = &autog.DoAction {
-	Do: func (content string) (ok bool, reflection string) {
-		action := GetChromeAction()
-		if action.NeedRun(content) {
-			cok, _, payload := action.Check(content)
-			if cok {
-				rok, rerr := action.Run(content, payload)
-				return rok, rerr
+			if err != nil {
+				s.ShowAgentLog(1, fmt.Sprintf("Embedding HTML (%d/%d) Retry...\n", len(texts), finished))
+				return tried < 1
 			}
+			s.ShowAgentLog(1, fmt.Sprintf("Embedding HTML (%d/%d) Done!\n", len(texts), finished))
+			return false
 		}
-		return true, ""
-	},
+
+		err := s.Agent.Rag.Indexing(cxt, "/html", currentHtml, splitter, true)
+		if err != nil {
+			s.ShowAgentLog(-1, fmt.Sprintf("RAG Indexing ERROR: %s\n", err))
+			return "", err
+		}
+	}
+
+	s.ShowAgentLog(1, fmt.Sprintf("Retrieval HTML...\n"))
+	var scoredss []autog.ScoredChunks
+	var err error
+	scoredss, err  = s.Agent.Rag.Retrieval(cxt, "/html", []string{query}, s.Cfg.TopK)
+	if err != nil {
+		s.ShowAgentLog(-1, fmt.Sprintf("RAG Retrieval ERROR: %s\n", err))
+		s.Agent.LastHtml = ""
+		return "", err
+	}
+
+	content := "最新的HTML内容如下\nHTML:\n"
+	for _, scoreds := range scoredss {
+		for _, scored := range scoreds {
+			content += fmt.Sprintf("...\n%s\n...\n", scored.Chunk.GetContent())
+		}
+	}
+
+	s.Agent.LastHtmlContext = content
+	s.Agent.LastHtml = currentHtml
+	return content, nil
 }
 
-func CreateMemoryRag(embedmodel autog.EmbeddingModel, chunkBatch int, routines int) *autog.Rag {
+func CreateMemoryRag(embedmodel autog.EmbeddingModel, chunkBatch int, routines int) (*autog.Rag, error) {
 	memDB, err := rag.NewMemDatabase()
 	if err != nil {
-		fmt.Printf("CreateMemoryRag ERROR: %s\n", err)
-		os.Exit(0)
+		return nil, err
 	}
 
 	memRag := &autog.Rag{
@@ -178,30 +189,40 @@ func CreateMemoryRag(embedmodel autog.EmbeddingModel, chunkBatch int, routines i
 		EmbeddingRoutines: routines,
 	}
 
-	return memRag
+	return memRag, nil
 }
 
-func ShowAgentLog(level int, str string) {
-	if chromeAgent == nil || chromeAgent.ShowLog == nil {
+func (s *Session) ShowAgentLog(level int, str string) {
+	if s.Agent == nil || s.Agent.ShowLog == nil {
 		return
 	}
-	chromeAgent.ShowLog(level, str)
+	s.Agent.ShowLog(level, GetVault(s.Cfg).Mask(str))
 }
 
-func GetLastHtmlContext() string {
-	if chromeAgent != nil {
-		return chromeAgent.LastHtmlContext
+func (s *Session) GetLastHtmlContext() string {
+	if len(s.Agent.LastHtmlContext) > 0 {
+		return s.Agent.LastHtmlContext
 	}
 	return "Empty!\n"
 }
 
-func RunChromeAgent(cfg *Configs, llm autog.LLM, embedmodel autog.EmbeddingModel, query string) {
-	cxt, cancel := context.WithCancel(context.Background())
+func (s *Session) RunChromeAgent(llm autog.LLM, embedmodel autog.EmbeddingModel, query string) ActionResult {
+	return s.RunChromeAgentContext(context.Background(), llm, embedmodel, query)
+}
+
+// Canceling parent stops the agent and the running action, like Ctrl + C, a parent which is never canceled cancels on Ctrl + C
+func (s *Session) RunChromeAgentContext(parent context.Context, llm autog.LLM, embedmodel autog.EmbeddingModel, query string) ActionResult {
+	cxt, cancel := context.WithCancel(parent)
+	s.Action.Executor.ChromeSetInterrupt(parent.Done())
+	defer s.Action.Executor.ChromeSetInterrupt(nil)
 
 	sigChan := make(chan os.Signal, 1)
 	done := make(chan bool)
 
-	signal.Notify(sigChan, syscall.SIGINT)
+	if parent.Done() == nil {
+		// Sessions of the server are canceled by their requests, not all at once
+		signal.Notify(sigChan, syscall.SIGINT)
+	}
 
     go func() {
         select {
@@ -218,16 +239,36 @@ func RunChromeAgent(cfg *Configs, llm autog.LLM, embedmodel autog.EmbeddingModel
 		signal.Stop(sigChan)
 	}()
 
-	if chromeAgent.Rag == nil {
-		chromeAgent.Rag = CreateMemoryRag(embedmodel, cfg.ChunkBatch, cfg.ChunkRoutines)
+	if s.Agent.Rag == nil {
+		// Unchanged chunks of a changed page reuse their embeddings
+		memRag, err := CreateMemoryRag(GetEmbeddingCache(s.Cfg, embedmodel), s.Cfg.ChunkBatch, s.Cfg.ChunkRoutines)
+		if err != nil {
+			s.ShowAgentLog(-1, fmt.Sprintf("CreateMemoryRag ERROR: %s\n", err))
+			return ActionResult{Error: fmt.Sprintf("CreateMemoryRag ERROR: %s", err)}
+		}
+		s.Agent.Rag = memRag
 	}
-	chromeAgent.Cfg   = cfg
-	chromeAgent.Query = query
-	chromeAgent.Prompt(systemPrompt, longHistory, shortHistory).
-    ReadQuestion(cxt, input, output).
+	s.Agent.Query = query
+	s.Action.Result = ActionResult{}
+	prompts := []*autog.PromptItem{systemPrompt}
+	if s.Cfg.ActionProtocol == ActionProtocolTools {
+		prompts = append(prompts, toolPrompt)
+	}
+	if s.Agent.Extract {
+		prompts = append(prompts, extractPrompt)
+	}
+	prompts = append(prompts, s.longHistory(), s.shortHistory())
+	s.Agent.Prompt(prompts...).
+    ReadQuestion(cxt, s.input(), s.Output).
     AskLLM(llm, true). // `true` means stream response
     WaitResponse(cxt).
-    Action(doaction).
-    Reflection(nil, 3). // `nil` == no reflection
+    Action(s.doaction()).
+    Reflection(nil, s.Cfg.ActionRetry + 1). // `nil` == default reflection, retry failed actions
     Summarize(cxt, summaryPrompt, summaryPrefix, false) // `false` == disable force summary
+
+	result := s.Action.Result
+	if !result.Ran && s.Agent.ResponseStatus != autog.LLM_STATUS_OK {
+		result.Error = fmt.Sprintf("LLM ERROR: %s", s.Agent.ResponseMessage.Content)
+	}
+	return result
 }
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"context"
+	"regexp"
+	"strings"
+	"autochrome/executor/chrome"
+)
+
+const (
+	ContextModeHtml   = "html"
+	ContextModeAXTree = "axtree"
+)
+
+const maxAXNameLen = 80
+
+// Code using element numbers of a live page
+var refPattern = regexp.MustCompile(`chrome\.(ClickRef|TypeRef|RunTool)\(`)
+
+func truncateText(str string, n int) string {
+	runes := []rune(strings.Join(strings.Fields(str), " "))
+	if len(runes) > n {
+		return string(runes[:n]) + "..."
+	}
+	return string(runes)
+}
+
+func FormatAXNode(node *chrome.AXNode) string {
+	var sb strings.Builder
+	if node.Ref > 0 {
+		sb.WriteString(fmt.Sprintf("[%d] ", node.Ref))
+	}
+	sb.WriteString(fmt.Sprintf("%s %q", node.Role, truncateText(node.Name, maxAXNameLen)))
+	if len(node.Value) > 0 {
+		sb.WriteString(fmt.Sprintf(" value=%q", truncateText(node.Value, maxAXNameLen)))
+	}
+	if len(node.States) > 0 {
+		sb.WriteString(fmt.Sprintf(" [%s]", strings.Join(node.States, ",")))
+	}
+	if len(node.Selector) > 0 {
+		sb.WriteString(fmt.Sprintf(" selector: %s", node.Selector))
+	}
+	return sb.String()
+}
+
+// Page content sent to the model, by the context mode
+func (s *Session) PageContext(cxt context.Context, query string) (string, error) {
+	if s.Cfg.ContextMode == ContextModeAXTree {
+		content, err := s.AXTreeContext()
+		return s.Redactor.Redact(GetVault(s.Cfg).Mask(content)), err
+	}
+	content, err := s.RetrievalHtmlContext(cxt, query)
+	if err != nil || !s.Cfg.ElementMap {
+		return content, err
+	}
+	// Typed values are in the element map
+	content += s.Redactor.Redact(GetVault(s.Cfg).Mask(s.ElementMapContext()))
+	s.Agent.LastHtmlContext = content
+	return content, nil
+}
+
+// Numbered elements for chrome.ClickRef and chrome.TypeRef, empty if not available
+func (s *Session) ElementMapContext() string {
+	nodes, err := s.Action.Executor.ChromeElementMap()
+	if err != nil {
+		s.ShowAgentLog(-1, fmt.Sprintf("Element map ERROR: %s\n", err))
+		return ""
+	}
+	content := "当前页面的可交互元素编号如下，可以用chrome.ClickRef和chrome.TypeRef按编号操作：\n"
+	for _, node := range nodes {
+		content += fmt.Sprintf("[%d] %s %q\n", node.Ref, node.Role, truncateText(node.Name, maxAXNameLen))
+	}
+	return content
+}
+
+// Interactive elements from the accessibility tree, much smaller than HTML
+func (s *Session) AXTreeContext() (string, error) {
+	s.ShowAgentLog(1, fmt.Sprintf("Reading accessibility tree...\n"))
+	nodes, err := s.Action.Executor.ChromeElementMap()
+	if err != nil {
+		s.ShowAgentLog(-1, fmt.Sprintf("Accessibility tree ERROR: %s\n", err))
+		return "", err
+	}
+
+	url, _ := s.Action.Executor.ChromeGetUrl()
+	content := fmt.Sprintf("当前页面（%s）的可交互元素如下，格式为：[编号] 角色 \"名称\" 值 [状态] selector: CSS选择器\n请优先使用这里给出的编号或选择器：\n", url)
+	for _, node := range nodes {
+		content += "- " + FormatAXNode(node) + "\n"
+	}
+
+	s.Agent.LastHtmlContext = content
+	return content, nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"os"
+	"fmt"
+	"bufio"
+	"strings"
+	"encoding/json"
+	"github.com/autogorg/autog"
+)
+
+const (
+	BatchSuccess  = "success"
+	BatchFailed   = "failed"
+	BatchNoAction = "no_action"
+	BatchSkipped  = "skipped"
+)
+
+type BatchStep struct {
+	Index  int    `json:"index"`
+	Task   string `json:"task"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type BatchSummary struct {
+	Ok    bool        `json:"ok"`
+	Steps []BatchStep `json:"steps"`
+}
+
+// Tasks of -task first, then lines of -task-file
+func LoadTasks(cfg *Configs) ([]string, error) {
+	tasks := append([]string{}, cfg.Tasks...)
+	if len(cfg.TaskFile) <= 0 {
+		return tasks, nil
+	}
+
+	file, err := os.Open(cfg.TaskFile)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) <= 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		tasks = append(tasks, line)
+	}
+	return tasks, scanner.Err()
+}
+
+// Run tasks in order, stop at the first failure, print summary as JSON, return exit code
+func RunBatch(s *Session, llm autog.LLM, embedmodel autog.EmbeddingModel) int {
+	tasks, err := LoadTasks(s.Cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", Red(fmt.Sprintf("Load tasks ERROR: %s", err)))
+		return 1
+	}
+
+	summary := BatchSummary{Ok: true}
+	for i, task := range tasks {
+		step := BatchStep{Index: i + 1, Task: task, Status: BatchSkipped}
+		if summary.Ok {
+			fmt.Fprintf(os.Stderr, "%s", Green(fmt.Sprintf("## ---TASK %d/%d---\n", i+1, len(tasks))))
+			fmt.Fprintf(os.Stderr, "%s\n", BrightWhite(task))
+			result := s.RunChromeAgent(llm, embedmodel, task)
+			step.Error = result.Error
+			if result.Ran && result.Ok {
+				step.Status = BatchSuccess
+			} else if result.Ran || len(step.Error) > 0 {
+				// An LLM or RAG error never reached the model
+				step.Status = BatchFailed
+			} else {
+				step.Status = BatchNoAction
+			}
+			// Answered without running code is not a failure
+			summary.Ok = step.Status != BatchFailed
+		}
+		summary.Steps = append(summary.Steps, step)
+	}
+
+	out, err := json.Marshal(summary)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", Red(fmt.Sprintf("Summary ERROR: %s", err)))
+		return 1
+	}
+	fmt.Println(string(out))
+
+	if !summary.Ok {
+		return 1
+	}
+	return 0
+}
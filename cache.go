@@ -0,0 +1,171 @@
+package main
+
+import (
+	"os"
+	"fmt"
+	"sync"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"path/filepath"
+	"github.com/autogorg/autog"
+)
+
+type cacheEntry struct {
+	Hash      string          `json:"hash"`
+	Embedding autog.Embedding `json:"embedding"`
+}
+
+// Embedding model keeping embeddings by content hash, only new texts are sent to the model
+type EmbeddingCache struct {
+	Model  autog.EmbeddingModel
+	// Vendor and model name, embeddings of different models never mix
+	Name   string
+	// Empty keeps embeddings in memory only
+	Path   string
+	mutex  sync.Mutex
+	loaded bool
+	embeds map[string]autog.Embedding
+}
+
+var embeddingCacheOnce sync.Once
+var embeddingCache *EmbeddingCache
+
+// Shared by all sessions, sessions of the server get it at the same time
+func GetEmbeddingCache(cfg *Configs, embedmodel autog.EmbeddingModel) *EmbeddingCache {
+	embeddingCacheOnce.Do(func() {
+		name := cfg.ApiVendor + "/" + cfg.ModelEmbed
+		embeddingCache = &EmbeddingCache{Model: embedmodel, Name: name}
+		if cfg.DiskCache {
+			dir, err := GetCacheDir(cfg)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s\n", Red(fmt.Sprintf("Cache dir ERROR: %s, embeddings cached in memory only", err)))
+			} else {
+				sum := sha256.Sum256([]byte(name))
+				embeddingCache.Path = filepath.Join(dir, fmt.Sprintf("embeddings-%s.jsonl", hex.EncodeToString(sum[:8])))
+			}
+		}
+	})
+	return embeddingCache
+}
+
+func GetCacheDir(cfg *Configs) (string, error) {
+	dir := cfg.CacheDir
+	if len(dir) <= 0 {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(home, ".autochrome", "cache")
+	}
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+func (c *EmbeddingCache) hash(dimensions int, text string) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%d\x00%s", c.Name, dimensions, text)))
+	return hex.EncodeToString(sum[:])
+}
+
+// Must hold mutex
+func (c *EmbeddingCache) load() {
+	c.loaded = true
+	c.embeds = map[string]autog.Embedding{}
+	if len(c.Path) <= 0 {
+		return
+	}
+
+	file, err := os.Open(c.Path)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	// A broken last line of an interrupted write ends the loading
+	decoder := json.NewDecoder(file)
+	for {
+		var entry cacheEntry
+		if decoder.Decode(&entry) != nil {
+			break
+		}
+		c.embeds[entry.Hash] = entry.Embedding
+	}
+}
+
+// Must hold mutex
+func (c *EmbeddingCache) save(entries []cacheEntry) error {
+	if len(c.Path) <= 0 || len(entries) <= 0 {
+		return nil
+	}
+	file, err := os.OpenFile(c.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	encoder := json.NewEncoder(file)
+	for _, entry := range entries {
+		err = encoder.Encode(entry)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *EmbeddingCache) Embeddings(cxt context.Context, dimensions int, texts []string) ([]autog.Embedding, error) {
+	embeds := make([]autog.Embedding, len(texts))
+	hashes := make([]string, len(texts))
+
+	var missTexts []string
+	var missIndexes []int
+
+	c.mutex.Lock()
+	if !c.loaded {
+		c.load()
+	}
+	for i, text := range texts {
+		hashes[i] = c.hash(dimensions, text)
+		if embed, ok := c.embeds[hashes[i]]; ok {
+			embeds[i] = embed
+		} else {
+			missTexts = append(missTexts, text)
+			missIndexes = append(missIndexes, i)
+		}
+	}
+	c.mutex.Unlock()
+
+	if len(missTexts) <= 0 {
+		return embeds, nil
+	}
+
+	missEmbeds, err := c.Model.Embeddings(cxt, dimensions, missTexts)
+	if err != nil {
+		return nil, err
+	}
+	if len(missEmbeds) != len(missTexts) {
+		return nil, fmt.Errorf("Embedding Error!")
+	}
+
+	var entries []cacheEntry
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for x, i := range missIndexes {
+		embeds[i] = missEmbeds[x]
+		if _, ok := c.embeds[hashes[i]]; !ok {
+			c.embeds[hashes[i]] = missEmbeds[x]
+			entries = append(entries, cacheEntry{Hash: hashes[i], Embedding: missEmbeds[x]})
+		}
+	}
+	err = c.save(entries)
+	if err != nil {
+		// Still usable in memory
+		c.Path = ""
+		fmt.Fprintf(os.Stderr, "%s\n", Red(fmt.Sprintf("Cache save ERROR: %s, embeddings cached in memory only", err)))
+	}
+	return embeds, nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"github.com/autogorg/autog"
+)
+
+type countingModel struct {
+	mutex sync.Mutex
+	texts int
+}
+
+func (m *countingModel) Embeddings(cxt context.Context, dimensions int, texts []string) ([]autog.Embedding, error) {
+	m.mutex.Lock()
+	m.texts += len(texts)
+	m.mutex.Unlock()
+	embeds := make([]autog.Embedding, len(texts))
+	for i, text := range texts {
+		embeds[i] = autog.Embedding{float64(len(text))}
+	}
+	return embeds, nil
+}
+
+func TestEmbeddingCacheShared(t *testing.T) {
+	model := &countingModel{}
+	cfg := &Configs{ApiVendor: "test", ModelEmbed: "test"}
+	var wg sync.WaitGroup
+	caches := make([]*EmbeddingCache, 8)
+	for i := range caches {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			caches[i] = GetEmbeddingCache(cfg, model)
+			if _, err := caches[i].Embeddings(context.Background(), 0, []string{"a", "bb"}); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	for _, cache := range caches {
+		if cache != caches[0] {
+			t.Fatalf("GetEmbeddingCache made more than one cache")
+		}
+	}
+	embeds, err := caches[0].Embeddings(context.Background(), 0, []string{"bb"})
+	if err != nil || len(embeds) != 1 || embeds[0][0] != 2 {
+		t.Errorf("Embeddings of a cached text = %v, %v", embeds, err)
+	}
+}
@@ -4,7 +4,9 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"strings"
 	_ "embed"
+	"autochrome/executor"
 )
 
 //go:embed VERSION
@@ -23,6 +25,39 @@ type Configs struct {
 	ChunkRoutines      int        `json:"chunk-routines"`
 	TopK               int        `json:"topk"`
 	URL                string     `json:"url"`
+	ExecProfile        string     `json:"exec-profile"`
+	AllowDomains       []string   `json:"allow-domains"`
+	DenyDomains        []string   `json:"deny-domains"`
+	ActionTimeout      int        `json:"action-timeout"`
+	ActionRetry        int        `json:"action-retry"`
+	Headless           bool       `json:"headless"`
+	Insecure           bool       `json:"insecure"`
+	UserDataDir        string     `json:"user-data-dir"`
+	Proxy              string     `json:"proxy"`
+	UserAgent          string     `json:"user-agent"`
+	ChromePath         string     `json:"chrome-path"`
+	ChromeFlags        []string   `json:"chrome-flags"`
+	RemoteUrl          string     `json:"remote-debugging-url"`
+	SessionDir         string     `json:"session-dir"`
+	AutoScreenshot     bool       `json:"auto-screenshot"`
+	Replay             string     `json:"replay"`
+	Tasks              []string   `json:"tasks"`
+	TaskFile           string     `json:"task-file"`
+	Serve              string     `json:"serve"`
+	ServeToken         string     `json:"-"`
+	MaxPages           int        `json:"max-pages"`
+	Confirm            bool       `json:"confirm"`
+	RiskCheck          bool       `json:"risk-check"`
+	VaultPath          string     `json:"vault"`
+	Redact             bool       `json:"redact"`
+	RedactRules        []string   `json:"redact-rules"`
+	RedactPatterns     []string   `json:"redact-patterns"`
+	ContextMode        string     `json:"context-mode"`
+	ActionProtocol     string     `json:"action-protocol"`
+	ElementMap         bool       `json:"element-map"`
+	Splitter           string     `json:"splitter"`
+	DiskCache          bool       `json:"disk-cache"`
+	CacheDir           string     `json:"cache-dir"`
 }
 
 var cfgInited bool
@@ -47,7 +82,20 @@ func getenvOrDefault(key string, defaultValue string) string {
 	return defaultValue
 }
 
+func splitList(str string) []string {
+	var list []string
+	for _, s := range strings.Split(str, ",") {
+		s = strings.TrimSpace(s)
+		if len(s) > 0 {
+			list = append(list, s)
+		}
+	}
+	return list
+}
+
 func ParseConfigs() *Configs {
+	var allowDomains, denyDomains, chromeFlags, redactRules string
+
     ClearConfigs(&cfg)
 
 	flag.BoolVar(&cfg.Version, "version", false, "Show the version number")
@@ -64,10 +112,55 @@ func ParseConfigs() *Configs {
 	flag.IntVar(&cfg.ChunkRoutines, "chunk-routines", 5, "Chunk routines for split text")
 
 	flag.IntVar(&cfg.TopK, "topk", 10, "TopK for RAG")
+	flag.StringVar(&cfg.ContextMode, "context-mode", ContextModeHtml, "Page content sent to the model (html or axtree)")
+	flag.StringVar(&cfg.ActionProtocol, "action-protocol", ActionProtocolCode, "How the model acts (code writes Go, tools calls functions, easier for weak models)")
+	flag.BoolVar(&cfg.ElementMap, "element-map", true, "Send numbered interactive elements with the HTML, for chrome.ClickRef and chrome.TypeRef")
+	flag.StringVar(&cfg.Splitter, "splitter", SplitterDom, "How to split HTML for RAG (dom or text)")
+	flag.BoolVar(&cfg.DiskCache, "disk-cache", false, "Keep HTML embeddings on disk, so pages visited again are not embedded again")
+	flag.StringVar(&cfg.CacheDir, "cache-dir", getenvOrDefault("CACHE_DIR", ""), "Directory of the disk cache (default ~/.autochrome/cache)")
 	flag.StringVar(&cfg.URL, "url", "", "URL to open")
+	flag.StringVar(&cfg.ExecProfile, "exec-profile", getenvOrDefault("EXEC_PROFILE", executor.ProfileStandard), "Packages allowed for generated code (strict, standard or unrestricted)")
+	flag.IntVar(&cfg.ActionTimeout, "action-timeout", 60, "Timeout for each action in seconds (0 means no timeout)")
+	flag.BoolVar(&cfg.Headless, "headless", false, "Run Chrome without a window")
+	flag.BoolVar(&cfg.Insecure, "insecure", true, "Run Chrome with no sandbox, no web security and ignoring certificate errors")
+	flag.StringVar(&cfg.UserDataDir, "user-data-dir", getenvOrDefault("USER_DATA_DIR", ""), "Chrome user data dir (empty uses a temporary profile)")
+	flag.StringVar(&cfg.Proxy, "proxy", getenvOrDefault("PROXY", ""), "Chrome proxy server, e.g. socks5://127.0.0.1:1080")
+	flag.StringVar(&cfg.UserAgent, "user-agent", "", "Chrome user agent")
+	flag.StringVar(&cfg.ChromePath, "chrome-path", getenvOrDefault("CHROME_PATH", ""), "Chrome executable path (empty finds it automatically)")
+	flag.StringVar(&chromeFlags, "chrome-flags", "", "Comma separated extra Chrome flags, e.g. lang=en-US,disable-extensions")
+	flag.StringVar(&cfg.RemoteUrl, "remote-debugging-url", getenvOrDefault("REMOTE_DEBUGGING_URL", ""), "Attach to a running Chrome, e.g. http://127.0.0.1:9222 (started with --remote-debugging-port=9222)")
+	flag.StringVar(&cfg.RemoteUrl, "ws-url", getenvOrDefault("REMOTE_DEBUGGING_URL", ""), "Alias of -remote-debugging-url")
+	flag.StringVar(&cfg.SessionDir, "session-dir", getenvOrDefault("SESSION_DIR", ""), "Directory to save sessions (default ~/.autochrome/sessions)")
+	flag.BoolVar(&cfg.AutoScreenshot, "auto-screenshot", false, "Save a screenshot after every action into the session directory")
+	flag.StringVar(&cfg.Replay, "replay", "", "Replay a recorded session.jsonl without the LLM, then exit")
+	flag.Func("task", "Instruction to run without interaction, can be repeated", func(task string) error {
+		cfg.Tasks = append(cfg.Tasks, task)
+		return nil
+	})
+	flag.StringVar(&cfg.TaskFile, "task-file", "", "File of instructions to run without interaction, one per line, # for comments")
+	flag.StringVar(&cfg.Serve, "serve", "", "Serve the HTTP API on this address instead of the prompt, e.g. :8080 (127.0.0.1 unless a host is given)")
+	flag.StringVar(&cfg.ServeToken, "serve-token", getenvOrDefault("SERVE_TOKEN", ""), "Bearer token required by the HTTP API (default a random one, printed at start)")
+	flag.IntVar(&cfg.ActionRetry, "action-retry", 2, "Max times to let the agent fix a failed action")
+	flag.IntVar(&cfg.MaxPages, "max-pages", 10, "Max pages of /crawl")
+	flag.BoolVar(&cfg.Confirm, "confirm", false, "Ask before running each action, to approve, reject or edit it")
+	flag.StringVar(&cfg.VaultPath, "vault", getenvOrDefault("VAULT_PATH", ""), "Encrypted file of secrets for chrome.Secret (default ~/.autochrome/secrets.vault, passphrase from VAULT_PASSPHRASE or asked)")
+	flag.BoolVar(&cfg.Redact, "redact", true, "Replace personal data and secrets of the page by placeholders before the model sees them")
+	flag.StringVar(&redactRules, "redact-rules", strings.Join(RedactRuleNames, ","), "Comma separated rules of -redact ("+strings.Join(RedactRuleNames, ", ")+")")
+	flag.Func("redact-pattern", "Regular expression of more text to redact, can be repeated", func(pattern string) error {
+		cfg.RedactPatterns = append(cfg.RedactPatterns, pattern)
+		return nil
+	})
+	flag.BoolVar(&cfg.RiskCheck, "risk-check", true, "Ask yes or no before high risk actions, e.g. paying, deleting or sending (rejected without a terminal)")
+	flag.StringVar(&allowDomains, "allow-domains", getenvOrDefault("ALLOW_DOMAINS", ""), "Comma separated domains allowed to navigate, every request of the browser is checked (empty allows all)")
+	flag.StringVar(&denyDomains, "deny-domains", getenvOrDefault("DENY_DOMAINS", ""), "Comma separated domains denied to navigate, every request of the browser is checked")
 
     flag.Parse()
 
+	cfg.AllowDomains = splitList(allowDomains)
+	cfg.DenyDomains  = splitList(denyDomains)
+	cfg.ChromeFlags  = splitList(chromeFlags)
+	cfg.RedactRules  = splitList(redactRules)
+
     if cfg.Version {
         fmt.Println(Version)
         os.Exit(0)
@@ -85,6 +178,37 @@ func ParseConfigs() *Configs {
 	if cfg.TopK < 1 {
 		cfg.TopK = 1
 	}
+	if cfg.ActionTimeout < 0 {
+		cfg.ActionTimeout = 0
+	}
+	if cfg.ActionRetry < 0 {
+		cfg.ActionRetry = 0
+	}
+	if cfg.MaxPages < 1 {
+		cfg.MaxPages = 1
+	}
+	if cfg.ContextMode != ContextModeHtml && cfg.ContextMode != ContextModeAXTree {
+		fmt.Printf("Context mode '%s' not supported!\n", cfg.ContextMode)
+		os.Exit(0)
+	}
+	if cfg.ActionProtocol != ActionProtocolCode && cfg.ActionProtocol != ActionProtocolTools {
+		fmt.Printf("Action protocol '%s' not supported!\n", cfg.ActionProtocol)
+		os.Exit(0)
+	}
+	if cfg.Splitter != SplitterDom && cfg.Splitter != SplitterText {
+		fmt.Printf("Splitter '%s' not supported!\n", cfg.Splitter)
+		os.Exit(0)
+	}
+	for _, rule := range cfg.RedactRules {
+		if !IsValidRedactRule(rule) {
+			fmt.Printf("Redact rule '%s' not supported!\n", rule)
+			os.Exit(0)
+		}
+	}
+	if !executor.IsValidProfile(cfg.ExecProfile) {
+		fmt.Printf("Executor profile '%s' not supported!\n", cfg.ExecProfile)
+		os.Exit(0)
+	}
 
     return &cfg
 }
\ No newline at end of file
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"go/token"
+	"go/scanner"
+	"encoding/json"
+	"autochrome/readline"
+	"autochrome/executor/chrome"
+)
+
+// Code block of the payload and its fence language
+func actionBlock(payload interface{}) (lang string, block string) {
+	if calls, ok := payload.([]*chrome.ToolCall); ok {
+		buf, _ := json.MarshalIndent(calls, "", "  ")
+		return "json", string(buf)
+	}
+	code, _ := payload.(string)
+	return "go", code
+}
+
+// Ask the user before the action runs, an edited block is checked again
+func (s *Session) ChromeActionConfirm(content string, payload interface{}) (ok bool, reflection string, newpayload interface{}) {
+	if !s.Cfg.Confirm || s.Action.Confirm == nil {
+		return true, "", payload
+	}
+	lang, block := actionBlock(payload)
+	edited, approved, feedback := s.Action.Confirm(lang, block)
+	if !approved {
+		s.Action.Result = ActionResult{Ran: true, Error: "Rejected by user"}
+		if len(feedback) <= 0 {
+			s.ShowActionLog(-1, fmt.Sprintf("ACTION: REJECTED -- by user\n"))
+			return false, "", payload
+		}
+		s.ShowActionLog(-1, fmt.Sprintf("ACTION: REJECTED -- %s\n", feedback))
+		return false, fmt.Sprintf("用户拒绝执行上面的代码，意见是：%s\n请根据用户的意见修改后重新输出完整的代码块。", feedback), payload
+	}
+	if edited == block {
+		return true, "", payload
+	}
+	cok, cerr, cpayload := s.Action.Check(fmt.Sprintf("\x60\x60\x60%s\n%s\n\x60\x60\x60", lang, edited))
+	if !cok && len(cerr) <= 0 {
+		cerr = "修改后的代码块为空。"
+	}
+	return cok, cerr, cpayload
+}
+
+// Colors of keywords, strings, numbers and comments, for Go and JSON
+func HighlightCode(code string) string {
+	var sb strings.Builder
+	var sc scanner.Scanner
+	src := []byte(code)
+	fset := token.NewFileSet()
+	file := fset.AddFile("", fset.Base(), len(src))
+	sc.Init(file, src, nil, scanner.ScanComments)
+	last := 0
+	for {
+		pos, tok, lit := sc.Scan()
+		if tok == token.EOF {
+			break
+		}
+		off := file.Offset(pos)
+		if off < last {
+			// Semicolons added at line ends are not in the source
+			continue
+		}
+		text := lit
+		if len(text) <= 0 || tok == token.SEMICOLON {
+			text = tok.String()
+		}
+		if off+len(text) > len(src) || string(src[off:off+len(text)]) != text {
+			continue
+		}
+		sb.Write(src[last:off])
+		last = off + len(text)
+		switch {
+		case tok == token.COMMENT:
+			text = BrightBlack(text)
+		case tok == token.STRING || tok == token.CHAR:
+			text = Green(text)
+		case tok == token.INT || tok == token.FLOAT:
+			text = Cyan(text)
+		case tok.IsKeyword() || text == "true" || text == "false" || text == "nil":
+			text = Purple(text)
+		}
+		sb.WriteString(text)
+	}
+	sb.Write(src[last:])
+	return sb.String()
+}
+
+// Approve in the terminal, only a full yes or no is taken
+func ApproveInTerminal(rl *readline.Instance) func(reasons []string, lang string, block string) bool {
+	return func(reasons []string, lang string, block string) bool {
+		prompt := *rl.Prompt
+		defer func() {
+			*rl.Prompt = prompt
+			rl.HistoryEnable()
+		}()
+		rl.HistoryDisable()
+		rl.Prompt.UseAlt = false
+		rl.Prompt.Prompt = "High risk action, run it? (yes/no): "
+		rl.Prompt.Placeholder = ""
+		fmt.Printf("%s\n%s\n", Yellow(fmt.Sprintf("## --- HIGH RISK (%s) ---", lang)), HighlightCode(block))
+		for _, reason := range reasons {
+			fmt.Printf("%s\n", Red("  - " + reason))
+		}
+		for {
+			answer, err := rl.Readline()
+			if err != nil {
+				return false
+			}
+			switch strings.ToLower(strings.TrimSpace(answer)) {
+			case "yes":
+				return true
+			case "no":
+				return false
+			}
+		}
+	}
+}
+
+// Confirm in the terminal: y runs, n rejects with feedback, e edits line by line
+func ConfirmInTerminal(rl *readline.Instance) func(lang string, block string) (string, bool, string) {
+	return func(lang string, block string) (string, bool, string) {
+		prompt := *rl.Prompt
+		defer func() {
+			*rl.Prompt = prompt
+			rl.HistoryEnable()
+		}()
+		rl.HistoryDisable()
+		rl.Prompt.UseAlt = false
+		for {
+			fmt.Printf("%s\n%s\n", Yellow(fmt.Sprintf("## --- CONFIRM (%s) ---", lang)), HighlightCode(block))
+			rl.Prompt.Prompt = "Run it? [y]es / [n]o / [e]dit: "
+			rl.Prompt.Placeholder = ""
+			answer, err := rl.Readline()
+			if err != nil {
+				return block, false, ""
+			}
+			switch strings.ToLower(strings.TrimSpace(answer)) {
+			case "y", "yes":
+				return block, true, ""
+			case "n", "no":
+				rl.Prompt.Prompt = "Why? (empty to stop): "
+				feedback, err := rl.Readline()
+				if err != nil {
+					return block, false, ""
+				}
+				return block, false, strings.TrimSpace(feedback)
+			case "e", "edit":
+				var lines []string
+				for i, line := range strings.Split(block, "\n") {
+					rl.Prompt.Prompt = fmt.Sprintf("%3d| ", i+1)
+					rl.Prefill = line
+					line, err = rl.Readline()
+					if err != nil {
+						// Keep the block as it was
+						lines = nil
+						break
+					}
+					lines = append(lines, line)
+				}
+				if lines != nil {
+					block = strings.Join(lines, "\n")
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package chrome
+
+import (
+	"fmt"
+	"context"
+	"encoding/json"
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/dom"
+	"github.com/chromedp/cdproto/runtime"
+	"github.com/chromedp/cdproto/accessibility"
+	"github.com/chromedp/chromedp"
+)
+
+// Interactive element of the accessibility tree
+type AXNode struct {
+	// Number in the element map, 0 if not numbered
+	Ref           int
+	BackendNodeID int64
+	Role          string
+	Name          string
+	Value         string
+	States        []string
+	Selector      string
+}
+
+var axInteractiveRoles = map[string]bool{
+	"button": true, "link": true, "textbox": true, "searchbox": true, "combobox": true,
+	"checkbox": true, "radio": true, "switch": true, "tab": true, "slider": true, "spinbutton": true,
+	"menuitem": true, "menuitemcheckbox": true, "menuitemradio": true, "option": true,
+	"listbox": true, "treeitem": true,
+}
+
+// Shown only when true
+var axStates = []accessibility.PropertyName{
+	accessibility.PropertyNameChecked,
+	accessibility.PropertyNameSelected,
+	accessibility.PropertyNameExpanded,
+	accessibility.PropertyNameDisabled,
+	accessibility.PropertyNameRequired,
+	accessibility.PropertyNameFocused,
+}
+
+const axObjectGroup = "autochrome-axtree"
+
+// Shortest css selector matching only this element, called on the element
+const axSelectorJs = `function() {
+	var el = this.nodeType === 1 ? this : this.parentElement;
+	if (!el) return "";
+	function unique(sel) {
+		try { return document.querySelectorAll(sel).length === 1; } catch (e) { return false; }
+	}
+	var tag = el.tagName.toLowerCase();
+	if (el.id && unique("#" + CSS.escape(el.id))) return "#" + CSS.escape(el.id);
+	var attrs = ["data-testid", "data-test", "data-qa", "name", "aria-label", "placeholder", "title", "href"];
+	for (var i = 0; i < attrs.length; i++) {
+		var v = el.getAttribute(attrs[i]);
+		if (v && v.length < 100) {
+			var sel = tag + "[" + attrs[i] + "=" + JSON.stringify(v) + "]";
+			if (unique(sel)) return sel;
+		}
+	}
+	var parts = [];
+	while (el && el.nodeType === 1 && el !== document.documentElement) {
+		if (el.id && unique("#" + CSS.escape(el.id))) {
+			parts.unshift("#" + CSS.escape(el.id));
+			break;
+		}
+		var part = el.tagName.toLowerCase();
+		var parent = el.parentElement;
+		if (parent) {
+			var same = Array.prototype.filter.call(parent.children, function(c) { return c.tagName === el.tagName; });
+			if (same.length > 1) part += ":nth-of-type(" + (same.indexOf(el) + 1) + ")";
+		}
+		parts.unshift(part);
+		el = parent;
+	}
+	return parts.join(" > ");
+}`
+
+func axString(value *accessibility.Value) string {
+	if value == nil || len(value.Value) <= 0 {
+		return ""
+	}
+	var v interface{}
+	if json.Unmarshal(value.Value, &v) != nil {
+		return ""
+	}
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+func axSelector(ctx context.Context, id cdp.BackendNodeID) (string, error) {
+	obj, err := dom.ResolveNode().WithBackendNodeID(id).WithObjectGroup(axObjectGroup).Do(ctx)
+	if err != nil {
+		return "", err
+	}
+	res, exp, err := runtime.CallFunctionOn(axSelectorJs).WithObjectID(obj.ObjectID).WithReturnByValue(true).Do(ctx)
+	if err != nil {
+		return "", err
+	}
+	if exp != nil {
+		return "", exp
+	}
+	var selector string
+	err = json.Unmarshal(res.Value, &selector)
+	return selector, err
+}
+
+// Interactive elements of the active tab, in document order
+func (c *Chrome) AXNodes() ([]*AXNode, string) {
+	if c.Context == nil {
+		return nil, "Tab is not opened!"
+	}
+	var nodes []*AXNode
+	err := chromedp.Run(c.Context, chromedp.ActionFunc(func(ctx context.Context) error {
+		tree, err := accessibility.GetFullAXTree().Do(ctx)
+		if err != nil {
+			return err
+		}
+		defer runtime.ReleaseObjectGroup(axObjectGroup).Do(ctx)
+
+		for _, n := range tree {
+			if n.Ignored || n.BackendDOMNodeID == 0 || !axInteractiveRoles[axString(n.Role)] {
+				continue
+			}
+			node := &AXNode{
+				BackendNodeID : int64(n.BackendDOMNodeID),
+				Role          : axString(n.Role),
+				Name          : axString(n.Name),
+				Value         : axString(n.Value),
+			}
+			for _, prop := range n.Properties {
+				for _, state := range axStates {
+					if prop.Name == state && axString(prop.Value) == "true" {
+						node.States = append(node.States, string(state))
+					}
+				}
+			}
+			// Element may be gone already, keep it without selector
+			node.Selector, _ = axSelector(ctx, n.BackendDOMNodeID)
+			nodes = append(nodes, node)
+		}
+		return nil
+	}))
+	if err != nil {
+		return nil, fmt.Sprintf("%s", err)
+	}
+	return nodes, ""
+}
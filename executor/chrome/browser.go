@@ -0,0 +1,85 @@
+package chrome
+
+import (
+	"sync"
+	"context"
+)
+
+// VarChrome of generated code, options, host guard and file paths stay with the executor
+type Browser struct {
+	// Context of the active tab
+	Context context.Context
+	Active  int
+}
+
+// Not a field of Browser, the interpreter can read unexported fields
+var browsers sync.Map
+
+func NewBrowser(c *Chrome) *Browser {
+	b := &Browser{}
+	browsers.Store(b, c)
+	b.sync()
+	return b
+}
+
+func (b *Browser) chrome() *Chrome {
+	c, ok := browsers.Load(b)
+	if !ok {
+		// Made by generated code, it is never opened
+		return New()
+	}
+	return c.(*Chrome)
+}
+
+func (b *Browser) sync() {
+	b.Context = b.chrome().Context
+	b.Active  = b.chrome().Active
+}
+
+func (b *Browser) GetUrl() string {
+	return b.chrome().GetUrl()
+}
+
+func (b *Browser) ListTabs() []*Tab {
+	defer b.sync()
+	return b.chrome().ListTabs()
+}
+
+func (b *Browser) OpenTab(url string) string {
+	defer b.sync()
+	return b.chrome().OpenTab(url)
+}
+
+func (b *Browser) SwitchTab(index int) string {
+	defer b.sync()
+	return b.chrome().SwitchTab(index)
+}
+
+func (b *Browser) CloseTab(index int) string {
+	defer b.sync()
+	return b.chrome().CloseTab(index)
+}
+
+// Only the file name of path is used, screenshots are saved in SaveDir
+func (b *Browser) Screenshot(path string) string {
+	path, errstr := savePath(b.chrome().SaveDir, path)
+	if len(errstr) > 0 {
+		return errstr
+	}
+	return b.chrome().Screenshot(path)
+}
+
+func (b *Browser) ScreenshotElement(path string, selector string) string {
+	path, errstr := savePath(b.chrome().SaveDir, path)
+	if len(errstr) > 0 {
+		return errstr
+	}
+	return b.chrome().ScreenshotElement(path, selector)
+}
+
+func (b *Browser) RunTasks(fun func (ctx context.Context) error) string {
+	// Tabs may be switched by the executor since the last task
+	b.sync()
+	defer b.sync()
+	return b.chrome().RunTasks(fun)
+}
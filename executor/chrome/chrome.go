@@ -3,21 +3,62 @@ package chrome
 import (
 	"fmt"
 	"os"
+	"errors"
 	"context"
 	"time"
+	"strings"
+	"encoding/json"
+	"syscall"
+	"os/signal"
 	"github.com/chromedp/chromedp"
 	"github.com/chromedp/chromedp/kb"
 )
 
+var ErrTimeout  = errors.New("Task timed out!")
+var ErrCanceled = errors.New("Task canceled!")
+
+type Options struct {
+	Headless    bool
+	Insecure    bool
+	UserDataDir string
+	Proxy       string
+	UserAgent   string
+	ExecPath    string
+	// Attach to a running chrome instead of launching one, e.g. ws://127.0.0.1:9222/
+	RemoteUrl   string
+	// Extra chrome flags, "name=value" or "name"
+	Flags       []string
+}
+
 type Chrome struct {
 	Width   int
 	Height  int
 	Url     string
 	Html    string
+	Timeout time.Duration
+	Options Options
 	BaseContext context.Context
 	BaseCancel  context.CancelFunc
+	// Owner of the browser, new tabs are opened from it
+	BrowserContext context.Context
+	BrowserCancel  context.CancelFunc
+	Tabs    []*Tab
+	Active  int
+	// Context of the active tab
 	Context context.Context
 	Cancel  context.CancelFunc
+	// Rows of Emit, kept until TakeEmitted
+	Emitted []json.RawMessage
+	// Hosts tabs may request, nil allows all, set before the first tab
+	HostGuard func (host string) bool
+	// Requests failed by HostGuard, kept until TakeBlocked
+	Blocked []*BlockedRequest
+	// Directory of screenshots taken by generated code and tools
+	SaveDir string
+	// Closed to cancel the running task instead of Ctrl + C, e.g. by a request of the server, nil cancels on Ctrl + C
+	Interrupt <-chan struct{}
+	guarded  map[string]bool
+	adopting map[string]*adoption
 }
 
 
@@ -28,12 +69,25 @@ func unused() {
 }
 
 func New() *Chrome {
-	return &Chrome{Width:800, Height:600}
+	return &Chrome{Width:800, Height:600, Options:Options{Insecure:true}}
 }
 
 func Delete(c *Chrome) {
-	if c.Cancel != nil {
-		c.Cancel()
+	browsers.Range(func(b, v any) bool {
+		if v == c {
+			browsers.Delete(b)
+		}
+		return true
+	})
+	for _, tab := range c.Tabs {
+		c.releaseTab(tab)
+	}
+	c.releaseAdopted(nil)
+	if c.BrowserCancel != nil {
+		c.BrowserCancel()
+	}
+	if c.BaseCancel != nil {
+		c.BaseCancel()
 	}
 }
 
@@ -47,6 +101,14 @@ func (c *Chrome) SetUrl(url string) {
 	c.Url = url
 }
 
+func (c *Chrome) SetOptions(opts Options) {
+	c.Options = opts
+}
+
+func (c *Chrome) SetTimeout(seconds int) {
+	c.Timeout = time.Duration(seconds) * time.Second
+}
+
 func (c *Chrome) GetHtml() string {
 	c.RefreshContext()
 	chromedp.Run(c.Context,
@@ -58,19 +120,113 @@ func (c *Chrome) GetHtml() string {
 	return c.Html
 }
 
-func (c *Chrome) NewTab() {
+func (c *Chrome) GetUrl() string {
+	var url string
+	if c.Context == nil {
+		return url
+	}
+	chromedp.Run(c.Context, chromedp.Location(&url))
+	return url
+}
+
+// Launch or attach the browser at first, later calls open a new tab in the same browser
+func (c *Chrome) NewTab() string {
+	if c.BrowserContext != nil && c.BrowserContext.Err() == nil {
+		return c.OpenTab("")
+	}
+
+	c.Tabs = nil
+	if len(c.Options.RemoteUrl) > 0 {
+		return c.attachRemote()
+	}
+
 	opts := append(chromedp.DefaultExecAllocatorOptions[:],
 		chromedp.NoFirstRun,
 		chromedp.NoDefaultBrowserCheck,
 		chromedp.DisableGPU,
-		chromedp.NoSandbox,
-		chromedp.IgnoreCertErrors,
-		chromedp.Flag("headless", false),
-		chromedp.Flag("disable-web-security", true),
+		chromedp.Flag("headless", c.Options.Headless),
 		chromedp.WindowSize(c.Width, c.Height),
+		chromedp.ModifyCmdFunc(detachCmd),
 	)
+	opts = append(opts, c.execOptions()...)
 	c.BaseContext, c.BaseCancel = chromedp.NewExecAllocator(context.Background(), opts...)
-	c.Context, c.Cancel = chromedp.NewContext(c.BaseContext)
+	// The first tab owns the browser, canceling it closes the browser
+	c.BrowserContext, c.BrowserCancel = chromedp.NewContext(c.BaseContext)
+	err := chromedp.Run(c.BrowserContext)
+	if err == nil {
+		err = c.guardTab(c.BrowserContext)
+	}
+	if err == nil {
+		err = c.guardBrowser(c.BrowserContext)
+	}
+	if err != nil {
+		// Never run unguarded
+		c.closeBrowser()
+		return fmt.Sprintf("%s", err)
+	}
+	c.Tabs = append(c.Tabs, &Tab{TargetID: targetID(c.BrowserContext), Context: c.BrowserContext, owned: true})
+	return c.SwitchTab(0)
+}
+
+// Attach to the first page of the running browser, open a new page if there is none
+func (c *Chrome) attachRemote() string {
+	c.BaseContext, c.BaseCancel = chromedp.NewRemoteAllocator(context.Background(), c.Options.RemoteUrl)
+	c.BrowserContext, c.BrowserCancel = chromedp.NewContext(c.BaseContext)
+
+	// Pages open already are guarded too, from now on
+	_, err := chromedp.Targets(c.BrowserContext)
+	if err == nil {
+		err = c.guardBrowser(c.BrowserContext)
+	}
+	if err != nil {
+		c.closeBrowser()
+		return fmt.Sprintf("%s", err)
+	}
+
+	c.refreshTabs()
+	if len(c.Tabs) > 0 {
+		return c.SwitchTab(0)
+	}
+	return c.OpenTab("")
+}
+
+func (c *Chrome) closeBrowser() {
+	Delete(c)
+	c.BrowserContext, c.BrowserCancel = nil, nil
+	c.BaseContext, c.BaseCancel = nil, nil
+	c.Tabs, c.Context, c.Cancel = nil, nil, nil
+}
+
+func (c *Chrome) execOptions() []chromedp.ExecAllocatorOption {
+	var opts []chromedp.ExecAllocatorOption
+	if c.Options.Insecure {
+		opts = append(opts,
+			chromedp.NoSandbox,
+			chromedp.IgnoreCertErrors,
+			chromedp.Flag("disable-web-security", true),
+		)
+	}
+	if len(c.Options.UserDataDir) > 0 {
+		opts = append(opts, chromedp.UserDataDir(c.Options.UserDataDir))
+	}
+	if len(c.Options.Proxy) > 0 {
+		opts = append(opts, chromedp.ProxyServer(c.Options.Proxy))
+	}
+	if len(c.Options.UserAgent) > 0 {
+		opts = append(opts, chromedp.UserAgent(c.Options.UserAgent))
+	}
+	if len(c.Options.ExecPath) > 0 {
+		opts = append(opts, chromedp.ExecPath(c.Options.ExecPath))
+	}
+	for _, flag := range c.Options.Flags {
+		name, value, found := strings.Cut(strings.TrimLeft(flag, "-"), "=")
+		if !found {
+			opts = append(opts, chromedp.Flag(name, true))
+		} else {
+			opts = append(opts, chromedp.Flag(name, value))
+		}
+	}
+	return opts
 }
 
 func (c *Chrome) RefreshContext() {
@@ -99,10 +255,28 @@ func (c *Chrome) RunTasks(fun func (ctx context.Context) error) string {
 	if fun == nil {
 		return "Task fun is nil!"
 	}
+	if c.Context == nil {
+		return "Tab is not opened!"
+	}
 
 	c.RefreshContext()
-	err := fun(c.Context)
+	ctx, cancel := c.taskContext()
+	defer cancel()
 
+	em := &emitter{}
+	err := fun(context.WithValue(context.WithValue(ctx, emitKey{}, em), saveDirKey{}, c.SaveDir))
+	if err == nil && ctx.Err() == nil {
+		// Rows of a failed task would come again when it is retried
+		c.Emitted = append(c.Emitted, em.rows...)
+	}
+	c.followPopup()
+
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return ErrTimeout.Error()
+	}
+	if errors.Is(ctx.Err(), context.Canceled) && c.Context.Err() == nil {
+		return ErrCanceled.Error()
+	}
 	if err != nil {
 		return fmt.Sprintf("%s", err)
 	}
@@ -110,3 +284,39 @@ func (c *Chrome) RunTasks(fun func (ctx context.Context) error) string {
 	return ""
 }
 
+// Context for one task, canceled on timeout or Ctrl + C, the tab itself stays open
+func (c *Chrome) taskContext() (context.Context, context.CancelFunc) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if c.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(c.Context, c.Timeout)
+	} else {
+		ctx, cancel = context.WithCancel(c.Context)
+	}
+
+	sigChan := make(chan os.Signal, 1)
+	done := make(chan bool)
+
+	if c.Interrupt == nil {
+		// Sessions of the server are canceled one by one, Ctrl + C there stops the server
+		signal.Notify(sigChan, syscall.SIGINT)
+	}
+
+	go func() {
+		select {
+		case <-sigChan:
+			cancel()
+		case <-c.Interrupt:
+			cancel()
+		case <-ctx.Done():
+		}
+		done <- true
+	}()
+
+	return ctx, func() {
+		cancel()
+		<-done
+		signal.Stop(sigChan)
+	}
+}
+
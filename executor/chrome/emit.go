@@ -0,0 +1,35 @@
+package chrome
+
+import (
+	"errors"
+	"context"
+	"encoding/json"
+)
+
+type emitKey struct{}
+
+// Value of the task context, rows emitted by the task
+type emitter struct {
+	rows []json.RawMessage
+}
+
+// Add a row to the result of the task, e.g. a struct or map of one record
+func Emit(ctx context.Context, value interface{}) error {
+	em, ok := ctx.Value(emitKey{}).(*emitter)
+	if !ok {
+		return errors.New("Emit needs the ctx of the task!")
+	}
+	buf, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	em.rows = append(em.rows, buf)
+	return nil
+}
+
+// Rows emitted since the last call, as JSON
+func (c *Chrome) TakeEmitted() []json.RawMessage {
+	rows := c.Emitted
+	c.Emitted = nil
+	return rows
+}
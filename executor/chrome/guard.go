@@ -0,0 +1,241 @@
+package chrome
+
+import (
+	"fmt"
+	"sync"
+	"time"
+	"context"
+	"net/url"
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/fetch"
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/cdproto/target"
+	"github.com/chromedp/chromedp"
+)
+
+// Request of a tab failed by the host guard
+type BlockedRequest struct {
+	Url          string `json:"url"`
+	ResourceType string `json:"resource_type"`
+	// Page of the tab itself, not a resource or an iframe
+	Navigation   bool   `json:"navigation"`
+}
+
+var blockedMutex sync.Mutex
+
+// Targets with the guard on, and pages guarded on attach but not yet taken by a tab
+var guardMutex sync.Mutex
+
+// Longest wait for the guard of a page attached automatically
+const adoptTimeout = 10 * time.Second
+
+// Page attached automatically, done is closed when its guard is on, tab is nil if it could not be guarded
+type adoption struct {
+	done chan struct{}
+	tab  *Tab
+}
+
+// Adoption of a target, made by whichever of the attach event and the tab comes first
+func (c *Chrome) adoption(id string) *adoption {
+	guardMutex.Lock()
+	defer guardMutex.Unlock()
+	if c.adopting == nil {
+		c.adopting = map[string]*adoption{}
+	}
+	a, ok := c.adopting[id]
+	if !ok {
+		a = &adoption{done: make(chan struct{})}
+		c.adopting[id] = a
+	}
+	return a
+}
+
+// Requests of the tab to hosts the guard rejects fail as blocked by client, must be called before the tab loads anything
+func (c *Chrome) guardTab(ctx context.Context) error {
+	guard := c.HostGuard
+	if guard == nil {
+		return nil
+	}
+	chromedp.ListenTarget(ctx, func(ev interface{}) {
+		paused, ok := ev.(*fetch.EventRequestPaused)
+		if !ok {
+			return
+		}
+		// Commands can not be sent from the listener
+		go func() {
+			exec := cdp.WithExecutor(ctx, chromedp.FromContext(ctx).Target)
+			u, err := url.Parse(paused.Request.URL)
+			if err != nil || len(u.Hostname()) <= 0 || guard(u.Hostname()) {
+				fetch.ContinueRequest(paused.RequestID).Do(exec)
+				return
+			}
+			blockedMutex.Lock()
+			c.Blocked = append(c.Blocked, &BlockedRequest{
+				Url:          paused.Request.URL,
+				ResourceType: string(paused.ResourceType),
+				// Main frame has the id of the target
+				Navigation:   paused.ResourceType == network.ResourceTypeDocument && string(paused.FrameID) == targetID(ctx),
+			})
+			blockedMutex.Unlock()
+			fetch.FailRequest(paused.RequestID, network.ErrorReasonBlockedByClient).Do(exec)
+		}()
+	})
+	err := chromedp.Run(ctx, fetch.Enable().WithPatterns([]*fetch.RequestPattern{{URLPattern: "*"}}))
+	if err != nil {
+		return fmt.Errorf("Host guard ERROR: %s", err)
+	}
+	guardMutex.Lock()
+	if c.guarded == nil {
+		c.guarded = map[string]bool{}
+	}
+	c.guarded[targetID(ctx)] = true
+	guardMutex.Unlock()
+	return nil
+}
+
+// Pages the browser opens by itself, e.g. by window.open, wait until their guard is on, ctx owns the browser
+func (c *Chrome) guardBrowser(ctx context.Context) error {
+	if c.HostGuard == nil {
+		return nil
+	}
+	chromedp.ListenBrowser(ctx, func(ev interface{}) {
+		attached, ok := ev.(*target.EventAttachedToTarget)
+		if !ok {
+			return
+		}
+		// Known before the command which attached it returns, commands can not be sent from the listener
+		a := c.adoption(string(attached.TargetInfo.TargetID))
+		go c.adoptTarget(ctx, attached, a)
+	})
+	browser := chromedp.FromContext(ctx).Browser
+	err := target.SetAutoAttach(true, true).WithFlatten(true).Do(cdp.WithExecutor(ctx, browser))
+	if err != nil {
+		return fmt.Errorf("Host guard ERROR: %s", err)
+	}
+	return nil
+}
+
+// Guard a page attached automatically before it goes on, the only session which guards it, a new page which can not be guarded is closed
+func (c *Chrome) adoptTarget(ctx context.Context, attached *target.EventAttachedToTarget, a *adoption) {
+	defer func() {
+		if a.tab == nil {
+			// Nothing to take, a tab waiting for it still has it
+			guardMutex.Lock()
+			delete(c.adopting, string(attached.TargetInfo.TargetID))
+			guardMutex.Unlock()
+		}
+		close(a.done)
+	}()
+	exec := cdp.WithExecutor(ctx, chromedp.FromContext(ctx).Browser)
+	info := attached.TargetInfo
+	guardMutex.Lock()
+	guarded := c.guarded[string(info.TargetID)]
+	guardMutex.Unlock()
+
+	if info.Type == "page" && !guarded {
+		tctx, cancel := chromedp.NewContext(ctx, chromedp.WithTargetID(info.TargetID))
+		err := chromedp.Run(tctx)
+		if err == nil {
+			err = c.guardTab(tctx)
+		}
+		if err == nil {
+			a.tab = &Tab{TargetID: string(info.TargetID), Context: tctx, Cancel: cancel}
+		} else {
+			releaseContext(tctx, cancel)
+			if attached.WaitingForDebugger {
+				target.CloseTarget(info.TargetID).Do(exec)
+				return
+			}
+		}
+	}
+	// Without the automatic session a waiting page goes on
+	target.DetachFromTarget().WithSessionID(attached.SessionID).Do(exec)
+}
+
+// Guarded context of a page attached automatically, waits while its guard is being enabled, nil if there is none
+func (c *Chrome) takeAdopted(id string) *Tab {
+	if c.HostGuard == nil {
+		return nil
+	}
+	a := c.adoption(id)
+	select {
+	case <-a.done:
+	case <-time.After(adoptTimeout):
+	}
+	guardMutex.Lock()
+	defer guardMutex.Unlock()
+	delete(c.adopting, id)
+	select {
+	case <-a.done:
+		return a.tab
+	default:
+		// Still going, released by Delete
+		c.adopting[id] = a
+		return nil
+	}
+}
+
+// New page of the browser, created by the browser so it waits for adoptTarget and only that session guards it
+func (c *Chrome) createTab() (context.Context, context.CancelFunc, error) {
+	if c.HostGuard == nil {
+		ctx, cancel := chromedp.NewContext(c.BrowserContext)
+		return ctx, cancel, chromedp.Run(ctx)
+	}
+	browser := chromedp.FromContext(c.BrowserContext).Browser
+	id, err := target.CreateTarget("about:blank").Do(cdp.WithExecutor(c.BrowserContext, browser))
+	if err != nil {
+		return nil, nil, err
+	}
+	tab := c.takeAdopted(string(id))
+	if tab == nil {
+		target.CloseTarget(id).Do(cdp.WithExecutor(c.BrowserContext, browser))
+		return nil, nil, fmt.Errorf("Host guard ERROR: page %s is not guarded", id)
+	}
+	return tab.Context, tab.Cancel, nil
+}
+
+// Cancel a context without closing its target
+func releaseContext(ctx context.Context, cancel context.CancelFunc) {
+	// chromedp closes the target of a canceled context unless it has no id
+	if t := chromedp.FromContext(ctx).Target; t != nil {
+		t.TargetID = ""
+	}
+	cancel()
+}
+
+// Release adopted pages which are not alive, nil releases all
+func (c *Chrome) releaseAdopted(alive map[string]bool) {
+	var released []*Tab
+	guardMutex.Lock()
+	for id, a := range c.adopting {
+		if alive[id] {
+			continue
+		}
+		select {
+		case <-a.done:
+			if a.tab != nil {
+				released = append(released, a.tab)
+			}
+		default:
+			if alive != nil {
+				// Its page may not be listed yet
+				continue
+			}
+		}
+		delete(c.adopting, id)
+	}
+	// Not under the lock, the attach listener of the browser takes it
+	guardMutex.Unlock()
+	for _, tab := range released {
+		releaseContext(tab.Context, tab.Cancel)
+	}
+}
+
+// Requests blocked since the last call
+func (c *Chrome) TakeBlocked() []*BlockedRequest {
+	blockedMutex.Lock()
+	defer blockedMutex.Unlock()
+	blocked := c.Blocked
+	c.Blocked = nil
+	return blocked
+}
@@ -0,0 +1,77 @@
+package chrome
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+	"github.com/chromedp/chromedp"
+)
+
+// Chrome of the machine, the test is skipped without one
+func testExecPath(t *testing.T) string {
+	for _, name := range []string{"headless_shell", "chromium", "chromium-browser", "google-chrome", "google-chrome-stable", "chrome"} {
+		if path, err := exec.LookPath(name); err == nil {
+			return path
+		}
+	}
+	t.Skip("Chrome is not found")
+	return ""
+}
+
+// Fails instead of hanging when the guard of a new page deadlocks
+func within(t *testing.T, name string, fun func() string) {
+	done := make(chan string, 1)
+	go func() {
+		done <- fun()
+	}()
+	select {
+	case errstr := <-done:
+		if len(errstr) > 0 {
+			t.Fatalf("%s: %s", name, errstr)
+		}
+	case <-time.After(60 * time.Second):
+		t.Fatalf("%s: still waiting after 60 seconds", name)
+	}
+}
+
+func TestGuardNewPages(t *testing.T) {
+	c := New()
+	c.Options.Headless = true
+	c.Options.ExecPath = testExecPath(t)
+	c.HostGuard = func(host string) bool {
+		return host != "blocked.invalid"
+	}
+	defer Delete(c)
+
+	within(t, "NewTab", c.NewTab)
+	within(t, "OpenTab", func() string {
+		return c.OpenTab("")
+	})
+	within(t, "window.open", func() string {
+		return c.RunTasks(func(ctx context.Context) error {
+			return chromedp.Run(ctx, chromedp.Evaluate(`window.open("http://blocked.invalid/"), true`, nil))
+		})
+	})
+	time.Sleep(2 * time.Second)
+
+	tabs := c.ListTabs()
+	if len(tabs) != 3 {
+		t.Fatalf("ListTabs: %d tabs, want 3", len(tabs))
+	}
+	within(t, "SwitchTab", func() string {
+		return c.SwitchTab(len(tabs) - 1)
+	})
+
+	var navs []string
+	for _, req := range c.TakeBlocked() {
+		if req.Navigation {
+			navs = append(navs, req.Url)
+		}
+	}
+	// Once, a page guarded twice would block it twice
+	if len(navs) != 1 || !strings.Contains(navs[0], "blocked.invalid") {
+		t.Errorf("Blocked navigations: %v, want the popup once", navs)
+	}
+}
@@ -0,0 +1,16 @@
+//go:build !linux && !windows
+
+package chrome
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// Own process group, so Ctrl + C in terminal does not kill the browser
+func detachCmd(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = new(syscall.SysProcAttr)
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
@@ -0,0 +1,14 @@
+package chrome
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// Own process group, so Ctrl + C in console does not kill the browser
+func detachCmd(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = new(syscall.SysProcAttr)
+	}
+	cmd.SysProcAttr.CreationFlags |= syscall.CREATE_NEW_PROCESS_GROUP
+}
@@ -0,0 +1,142 @@
+package chrome
+
+import (
+	"fmt"
+	"sync"
+	"context"
+	"encoding/json"
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/dom"
+	"github.com/chromedp/cdproto/runtime"
+	"github.com/chromedp/chromedp"
+)
+
+// Numbered elements of the last element map, by target id of the tab
+var refMutex sync.Mutex
+var refNodes = map[string]map[int]cdp.BackendNodeID{}
+
+const refClearJs = `function() {
+	if ("value" in this) {
+		this.value = "";
+		this.dispatchEvent(new Event("input", {bubbles: true}));
+	} else if (this.isContentEditable) {
+		this.textContent = "";
+	}
+}`
+
+// Number the interactive elements of the active tab, for ClickRef and TypeRef
+func (c *Chrome) ElementMap() ([]*AXNode, string) {
+	nodes, errstr := c.AXNodes()
+	if len(errstr) > 0 {
+		return nil, errstr
+	}
+	refs := map[int]cdp.BackendNodeID{}
+	for i, node := range nodes {
+		node.Ref = i + 1
+		refs[node.Ref] = cdp.BackendNodeID(node.BackendNodeID)
+	}
+
+	refMutex.Lock()
+	defer refMutex.Unlock()
+	refNodes[targetID(c.Context)] = refs
+	return nodes, ""
+}
+
+func refNode(ctx context.Context, ref int) (cdp.BackendNodeID, error) {
+	refMutex.Lock()
+	defer refMutex.Unlock()
+	id, ok := refNodes[targetID(ctx)][ref]
+	if !ok {
+		return 0, fmt.Errorf("Element [%d] not in the element map of this tab!", ref)
+	}
+	return id, nil
+}
+
+// Call a javascript function on the element, arguments and result by JSON
+func callNode(ctx context.Context, id cdp.BackendNodeID, fun string, args ...interface{}) ([]byte, error) {
+	obj, err := dom.ResolveNode().WithBackendNodeID(id).Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer runtime.ReleaseObject(obj.ObjectID).Do(ctx)
+
+	var callArgs []*runtime.CallArgument
+	for _, arg := range args {
+		buf, err := json.Marshal(arg)
+		if err != nil {
+			return nil, err
+		}
+		callArgs = append(callArgs, &runtime.CallArgument{Value: buf})
+	}
+	res, exp, err := runtime.CallFunctionOn(fun).WithObjectID(obj.ObjectID).WithArguments(callArgs).WithReturnByValue(true).Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if exp != nil {
+		return nil, exp
+	}
+	return res.Value, nil
+}
+
+// Must run with chromedp.Run
+func clickNode(ctx context.Context, id cdp.BackendNodeID) error {
+	err := dom.ScrollIntoViewIfNeeded().WithBackendNodeID(id).Do(ctx)
+	if err != nil {
+		return err
+	}
+	quads, err := dom.GetContentQuads().WithBackendNodeID(id).Do(ctx)
+	if err != nil || len(quads) <= 0 || len(quads[0]) < 8 {
+		// Not rendered, e.g. covered input of a checkbox
+		_, err = callNode(ctx, id, `function() { this.click(); }`)
+		return err
+	}
+	var x, y float64
+	for i := 0; i < 8; i += 2 {
+		x += quads[0][i] / 4
+		y += quads[0][i+1] / 4
+	}
+	return chromedp.MouseClickXY(x, y).Do(ctx)
+}
+
+// Must run with chromedp.Run
+func typeNode(ctx context.Context, id cdp.BackendNodeID, text string) error {
+	err := dom.Focus().WithBackendNodeID(id).Do(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = callNode(ctx, id, refClearJs)
+	if err != nil {
+		return err
+	}
+	return chromedp.KeyEvent(text).Do(ctx)
+}
+
+// Click element [ref] of the element map
+func ClickRef(ctx context.Context, ref int) error {
+	id, err := refNode(ctx, ref)
+	if err != nil {
+		return err
+	}
+	return chromedp.Run(ctx, chromedp.ActionFunc(func(ctx context.Context) error {
+		err := clickNode(ctx, id)
+		if err != nil {
+			return fmt.Errorf("Element [%d] is gone, the page has changed: %s", ref, err)
+		}
+		return nil
+	}))
+}
+
+// Replace the text of element [ref] of the element map, as typed by keyboard
+func TypeRef(ctx context.Context, ref int, text string) error {
+	id, err := refNode(ctx, ref)
+	if err != nil {
+		return err
+	}
+	return chromedp.Run(ctx, chromedp.ActionFunc(func(ctx context.Context) error {
+		err := typeNode(ctx, id, text)
+		if err != nil {
+			return fmt.Errorf("Element [%d] is gone or can not be focused: %s", ref, err)
+		}
+		return nil
+	}))
+}
@@ -0,0 +1,70 @@
+package chrome
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"path/filepath"
+	"github.com/chromedp/chromedp"
+)
+
+func screenshotQuality(path string) int {
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext == ".jpg" || ext == ".jpeg" {
+		return 90
+	}
+	// 100 means png
+	return 100
+}
+
+type saveDirKey struct{}
+
+// Screenshots of generated code and tools go to the save directory, whatever directory they ask for
+func savePath(dir string, path string) (string, string) {
+	if len(dir) <= 0 {
+		return "", "Screenshot directory is not set!"
+	}
+	name := filepath.Base(path)
+	if name == "." || name == "/" || name == ".." {
+		return "", fmt.Sprintf("Screenshot file name '%s' is invalid!", path)
+	}
+	return filepath.Join(dir, name), ""
+}
+
+func writeScreenshot(path string, buf []byte) string {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return fmt.Sprintf("%s", err)
+	}
+	err = os.WriteFile(path, buf, 0644)
+	if err != nil {
+		return fmt.Sprintf("%s", err)
+	}
+	return ""
+}
+
+// Save full page screenshot of the active tab, .jpg or .png by extension
+func (c *Chrome) Screenshot(path string) string {
+	if c.Context == nil {
+		return "Tab is not opened!"
+	}
+	var buf []byte
+	err := chromedp.Run(c.Context, chromedp.FullScreenshot(&buf, screenshotQuality(path)))
+	if err != nil {
+		return fmt.Sprintf("%s", err)
+	}
+	return writeScreenshot(path, buf)
+}
+
+// Save screenshot of the first element matching the css selector, always png
+func (c *Chrome) ScreenshotElement(path string, selector string) string {
+	if c.Context == nil {
+		return "Tab is not opened!"
+	}
+	var buf []byte
+	err := chromedp.Run(c.Context, chromedp.Screenshot(selector, &buf, chromedp.ByQuery))
+	if err != nil {
+		return fmt.Sprintf("%s", err)
+	}
+	return writeScreenshot(path, buf)
+}
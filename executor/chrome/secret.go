@@ -0,0 +1,25 @@
+package chrome
+
+import (
+	"sync"
+)
+
+var secretMutex sync.Mutex
+var secrets = map[string]string{}
+
+// Secrets of the vault, set by autochrome, not by generated code
+func SetSecrets(values map[string]string) {
+	secretMutex.Lock()
+	defer secretMutex.Unlock()
+	secrets = map[string]string{}
+	for name, value := range values {
+		secrets[name] = value
+	}
+}
+
+// Value of the secret NAME of the vault, empty if there is none
+func Secret(name string) string {
+	secretMutex.Lock()
+	defer secretMutex.Unlock()
+	return secrets[name]
+}
@@ -0,0 +1,228 @@
+package chrome
+
+import (
+	"fmt"
+	"context"
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/page"
+	"github.com/chromedp/cdproto/target"
+	"github.com/chromedp/chromedp"
+)
+
+type Tab struct {
+	TargetID string
+	OpenerID string
+	Title    string
+	Url      string
+	// Nil until the tab is attached
+	Context  context.Context
+	Cancel   context.CancelFunc
+	// Opened by this process, other pages of an attached browser are only detached
+	owned    bool
+}
+
+func targetID(ctx context.Context) string {
+	c := chromedp.FromContext(ctx)
+	if c == nil || c.Target == nil {
+		return ""
+	}
+	return string(c.Target.TargetID)
+}
+
+// Sync tabs with the pages of the browser, pages opened by others (e.g. window.open) go last
+func (c *Chrome) refreshTabs() {
+	if c.BrowserContext == nil {
+		return
+	}
+	targets, err := chromedp.Targets(c.BrowserContext)
+	if err != nil {
+		return
+	}
+
+	pages := map[string]*target.Info{}
+	alive := map[string]bool{}
+	for _, t := range targets {
+		if t.Type == "page" {
+			pages[string(t.TargetID)] = t
+		}
+		alive[string(t.TargetID)] = true
+	}
+	c.releaseAdopted(alive)
+
+	var tabs []*Tab
+	for _, tab := range c.Tabs {
+		info, ok := pages[tab.TargetID]
+		if !ok {
+			c.releaseTab(tab)
+			continue
+		}
+		tab.Title = info.Title
+		tab.Url   = info.URL
+		tabs = append(tabs, tab)
+		delete(pages, tab.TargetID)
+	}
+	for _, t := range targets {
+		if _, ok := pages[string(t.TargetID)]; ok {
+			tabs = append(tabs, &Tab{
+				TargetID: string(t.TargetID),
+				OpenerID: string(t.OpenerID),
+				Title:    t.Title,
+				Url:      t.URL,
+				// Popups of our pages are ours too
+				owned:    len(c.Options.RemoteUrl) <= 0 || c.ownsTarget(string(t.OpenerID)),
+			})
+		}
+	}
+	c.Tabs = tabs
+
+	c.Active = -1
+	for i, tab := range c.Tabs {
+		if tab.Context != nil && tab.Context == c.Context {
+			c.Active = i
+		}
+	}
+	if c.Active < 0 && len(c.Tabs) > 0 {
+		// Active tab was closed
+		c.SwitchTab(0)
+	}
+}
+
+// List tabs of the browser, the active one is Tabs[Active]
+func (c *Chrome) ListTabs() []*Tab {
+	c.refreshTabs()
+	return c.Tabs
+}
+
+// Open a new tab in the same browser and make it active
+func (c *Chrome) OpenTab(url string) string {
+	if c.BrowserContext == nil {
+		return "Browser is not opened!"
+	}
+
+	ctx, cancel, err := c.createTab()
+	if err != nil {
+		return fmt.Sprintf("%s", err)
+	}
+	if len(url) > 0 {
+		err = chromedp.Run(ctx, chromedp.Navigate(url))
+	}
+	if err != nil {
+		cancel()
+		return fmt.Sprintf("%s", err)
+	}
+
+	c.Url = url
+	c.Tabs = append(c.Tabs, &Tab{TargetID: targetID(ctx), Url: url, Context: ctx, Cancel: cancel, owned: true})
+	return c.SwitchTab(len(c.Tabs) - 1)
+}
+
+// Make tab N active, generated code and HTML retrieval work on the active tab
+func (c *Chrome) SwitchTab(index int) string {
+	if index < 0 || index >= len(c.Tabs) {
+		return fmt.Sprintf("Tab %d not exists!", index)
+	}
+
+	tab := c.Tabs[index]
+	if tab.Context == nil {
+		// Guarded since it was opened, e.g. a popup
+		if adopted := c.takeAdopted(tab.TargetID); adopted != nil {
+			tab.Context, tab.Cancel = adopted.Context, adopted.Cancel
+		}
+	}
+	if tab.Context == nil {
+		tab.Context, tab.Cancel = chromedp.NewContext(c.BrowserContext, chromedp.WithTargetID(target.ID(tab.TargetID)))
+		// Pages opened by others are guarded from now on
+		err := chromedp.Run(tab.Context)
+		if err == nil {
+			err = c.guardTab(tab.Context)
+		}
+		if err != nil {
+			return fmt.Sprintf("%s", err)
+		}
+	}
+
+	c.Active  = index
+	c.Context = tab.Context
+	c.Cancel  = tab.Cancel
+
+	err := chromedp.Run(tab.Context, page.BringToFront())
+	if err != nil {
+		return fmt.Sprintf("%s", err)
+	}
+	return ""
+}
+
+// Close tab N, the last tab can not be closed
+func (c *Chrome) CloseTab(index int) string {
+	c.refreshTabs()
+	if index < 0 || index >= len(c.Tabs) {
+		return fmt.Sprintf("Tab %d not exists!", index)
+	}
+	if len(c.Tabs) <= 1 {
+		return "Can not close the last tab!"
+	}
+
+	tab := c.Tabs[index]
+	if !tab.owned {
+		return fmt.Sprintf("Tab %d is not opened by autochrome, it can not be closed!", index)
+	}
+	refMutex.Lock()
+	delete(refNodes, tab.TargetID)
+	refMutex.Unlock()
+	if tab.Cancel != nil {
+		tab.Cancel()
+	} else {
+		// Not attached or owner of the browser, close the page only
+		browser := chromedp.FromContext(c.BrowserContext).Browser
+		err := target.CloseTarget(target.ID(tab.TargetID)).Do(cdp.WithExecutor(c.BrowserContext, browser))
+		if err != nil {
+			return fmt.Sprintf("%s", err)
+		}
+	}
+
+	c.Tabs = append(c.Tabs[:index], c.Tabs[index+1:]...)
+	if index == c.Active || c.Active >= len(c.Tabs) {
+		return c.SwitchTab(max(index - 1, 0))
+	}
+	if index < c.Active {
+		c.Active--
+	}
+	return ""
+}
+
+func (c *Chrome) ownsTarget(id string) bool {
+	for _, tab := range c.Tabs {
+		if len(id) > 0 && tab.TargetID == id {
+			return tab.owned
+		}
+	}
+	return false
+}
+
+// Cancel the context of a tab, pages not opened by us are detached but stay open
+func (c *Chrome) releaseTab(tab *Tab) {
+	if tab.Cancel == nil {
+		return
+	}
+	if !tab.owned {
+		releaseContext(tab.Context, tab.Cancel)
+		return
+	}
+	tab.Cancel()
+}
+
+func (c *Chrome) CloseActiveTab() string {
+	return c.CloseTab(c.Active)
+}
+
+// Follow the page opened by the active tab, e.g. window.open
+func (c *Chrome) followPopup() {
+	active := targetID(c.Context)
+	c.refreshTabs()
+	for i, tab := range c.Tabs {
+		if tab.Context == nil && len(active) > 0 && tab.OpenerID == active {
+			c.SwitchTab(i)
+			return
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package chrome
+
+import (
+	"fmt"
+	"context"
+	"encoding/json"
+	"github.com/chromedp/chromedp"
+)
+
+// Element an action is going to use, with the fields of its form
+type TargetInfo struct {
+	Ref        int      `json:"ref,omitempty"`
+	Selector   string   `json:"selector,omitempty"`
+	Tag        string   `json:"tag"`
+	Type       string   `json:"type"`
+	Text       string   `json:"text"`
+	FormFields []string `json:"form_fields"`
+}
+
+const targetInfoJs = `function(el) {
+	if (!el) {
+		return null;
+	}
+	var form = el.form || el.closest("form");
+	var fields = [];
+	if (form) {
+		form.querySelectorAll("input, select, textarea").forEach(function(f) {
+			fields.push([f.type || "", f.name || "", f.id || "", f.autocomplete || "", f.placeholder || ""].join(" "));
+		});
+	}
+	var text = el.innerText || el.value || el.getAttribute("aria-label") || el.getAttribute("title") || "";
+	return {tag: el.tagName.toLowerCase(), type: el.type || "", text: text.slice(0, 100), form_fields: fields};
+}`
+
+// Infos of elements by ref of the element map and by css selector, elements not found are skipped
+func (c *Chrome) TargetInfos(refs []int, selectors []string) ([]*TargetInfo, string) {
+	if c.Context == nil {
+		return nil, "Tab is not opened!"
+	}
+	var infos []*TargetInfo
+	err := chromedp.Run(c.Context, chromedp.ActionFunc(func(ctx context.Context) error {
+		for _, ref := range refs {
+			id, err := refNode(ctx, ref)
+			if err != nil {
+				continue
+			}
+			buf, err := callNode(ctx, id, fmt.Sprintf(`function() { return (%s)(this); }`, targetInfoJs))
+			if err != nil {
+				continue
+			}
+			info := &TargetInfo{}
+			if json.Unmarshal(buf, info) == nil && len(info.Tag) > 0 {
+				info.Ref = ref
+				infos = append(infos, info)
+			}
+		}
+		for _, selector := range selectors {
+			arg, _ := json.Marshal(selector)
+			var info *TargetInfo
+			// Not waited for, the element may come later
+			err := chromedp.Evaluate(fmt.Sprintf(`(%s)(document.querySelector(%s))`, targetInfoJs, arg), &info).Do(ctx)
+			if err != nil || info == nil {
+				continue
+			}
+			info.Selector = selector
+			infos = append(infos, info)
+		}
+		return nil
+	}))
+	if err != nil {
+		return infos, fmt.Sprintf("%s", err)
+	}
+	return infos, ""
+}
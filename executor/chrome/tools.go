@@ -0,0 +1,196 @@
+package chrome
+
+import (
+	"fmt"
+	"time"
+	"context"
+	"strings"
+	"encoding/json"
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/dom"
+	"github.com/chromedp/chromedp"
+)
+
+const (
+	ToolNavigate   = "navigate"
+	ToolClick      = "click"
+	ToolType       = "type"
+	ToolSelect     = "select"
+	ToolScroll     = "scroll"
+	ToolWait       = "wait"
+	ToolExtract    = "extract"
+	ToolScreenshot = "screenshot"
+)
+
+var ToolNames = []string{ToolNavigate, ToolClick, ToolType, ToolSelect, ToolScroll, ToolWait, ToolExtract, ToolScreenshot}
+
+// Element is given by Ref of the element map or by css Selector
+type ToolArgs struct {
+	Url       string  `json:"url,omitempty"`
+	Ref       int     `json:"ref,omitempty"`
+	Selector  string  `json:"selector,omitempty"`
+	Text      string  `json:"text,omitempty"`
+	Value     string  `json:"value,omitempty"`
+	Pixels    int     `json:"pixels,omitempty"`
+	Seconds   float64 `json:"seconds,omitempty"`
+	Attribute string  `json:"attribute,omitempty"`
+	Path      string  `json:"path,omitempty"`
+}
+
+type ToolCall struct {
+	Tool string   `json:"tool"`
+	Args ToolArgs `json:"args"`
+}
+
+const toolSelectJs = `function(value) {
+	var opts = Array.prototype.slice.call(this.options || []);
+	var opt = opts.find(function(o) { return o.value === value || o.text.trim() === value; });
+	if (!opt) throw new Error("Option '" + value + "' not found");
+	this.value = opt.value;
+	this.dispatchEvent(new Event("input", {bubbles: true}));
+	this.dispatchEvent(new Event("change", {bubbles: true}));
+}`
+
+const toolExtractJs = `function(attr) {
+	if (attr) return this.getAttribute(attr) || "";
+	return (this.innerText || this.value || "").trim();
+}`
+
+func IsValidTool(name string) bool {
+	for _, n := range ToolNames {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Nodes of the ref or the selector, the selector is waited for like chromedp does
+func toolNodes(ctx context.Context, args ToolArgs, all bool) ([]cdp.BackendNodeID, error) {
+	if args.Ref > 0 {
+		id, err := refNode(ctx, args.Ref)
+		if err != nil {
+			return nil, err
+		}
+		return []cdp.BackendNodeID{id}, nil
+	}
+	if len(args.Selector) <= 0 {
+		return nil, fmt.Errorf("Need 'ref' or 'selector'!")
+	}
+	var nodes []*cdp.Node
+	query := chromedp.ByQuery
+	if all {
+		query = chromedp.ByQueryAll
+	}
+	err := chromedp.Run(ctx, chromedp.Nodes(args.Selector, &nodes, query))
+	if err != nil {
+		return nil, err
+	}
+	var ids []cdp.BackendNodeID
+	for _, node := range nodes {
+		ids = append(ids, node.BackendNodeID)
+	}
+	return ids, nil
+}
+
+// Run one tool call on the tab of ctx, extract returns the values as JSON
+func RunTool(ctx context.Context, call *ToolCall) (string, error) {
+	args := call.Args
+	if call.Tool == ToolNavigate {
+		return "", chromedp.Run(ctx, chromedp.Navigate(args.Url))
+	}
+	if call.Tool == ToolScreenshot {
+		// Only the file name is taken from the model
+		dir, _ := ctx.Value(saveDirKey{}).(string)
+		path, errstr := savePath(dir, args.Path)
+		if len(errstr) > 0 {
+			return "", fmt.Errorf("%s", errstr)
+		}
+		var buf []byte
+		var err error
+		if len(args.Selector) > 0 {
+			err = chromedp.Run(ctx, chromedp.Screenshot(args.Selector, &buf, chromedp.ByQuery))
+		} else {
+			err = chromedp.Run(ctx, chromedp.FullScreenshot(&buf, screenshotQuality(path)))
+		}
+		if err != nil {
+			return "", err
+		}
+		if errstr := writeScreenshot(path, buf); len(errstr) > 0 {
+			return "", fmt.Errorf("%s", errstr)
+		}
+		return path, nil
+	}
+	if call.Tool == ToolWait && args.Ref <= 0 && len(args.Selector) <= 0 {
+		seconds := args.Seconds
+		if seconds <= 0 {
+			seconds = 1
+		}
+		return "", chromedp.Run(ctx, chromedp.Sleep(time.Duration(seconds * float64(time.Second))))
+	}
+	if call.Tool == ToolScroll && args.Ref <= 0 && len(args.Selector) <= 0 {
+		js := fmt.Sprintf(`window.scrollBy(0, %d || window.innerHeight)`, args.Pixels)
+		return "", chromedp.Run(ctx, chromedp.Evaluate(js, nil))
+	}
+	if call.Tool == ToolWait {
+		if args.Ref > 0 {
+			// Numbered elements exist already
+			return "", nil
+		}
+		return "", chromedp.Run(ctx, chromedp.WaitVisible(args.Selector, chromedp.ByQuery))
+	}
+
+	ids, err := toolNodes(ctx, args, call.Tool == ToolExtract)
+	if err != nil {
+		return "", err
+	}
+	var values []string
+	err = chromedp.Run(ctx, chromedp.ActionFunc(func(ctx context.Context) error {
+		switch call.Tool {
+		case ToolClick:
+			return clickNode(ctx, ids[0])
+		case ToolType:
+			return typeNode(ctx, ids[0], args.Text)
+		case ToolSelect:
+			_, err := callNode(ctx, ids[0], toolSelectJs, args.Value)
+			return err
+		case ToolScroll:
+			return dom.ScrollIntoViewIfNeeded().WithBackendNodeID(ids[0]).Do(ctx)
+		case ToolExtract:
+			for _, id := range ids {
+				res, err := callNode(ctx, id, toolExtractJs, args.Attribute)
+				if err != nil {
+					return err
+				}
+				var value string
+				json.Unmarshal(res, &value)
+				values = append(values, value)
+			}
+			return nil
+		}
+		return fmt.Errorf("Tool '%s' not supported!", call.Tool)
+	}))
+	if err != nil || call.Tool != ToolExtract {
+		return "", err
+	}
+	buf, err := json.Marshal(values)
+	return string(buf), err
+}
+
+// Run tool calls in order on the active tab, output of each call is one line
+func (c *Chrome) RunTools(calls []*ToolCall) (string, string) {
+	var lines []string
+	errstr := c.RunTasks(func(ctx context.Context) error {
+		for i, call := range calls {
+			out, err := RunTool(ctx, call)
+			if err != nil {
+				return fmt.Errorf("Tool %d '%s' failed: %s", i+1, call.Tool, err)
+			}
+			if len(out) > 0 {
+				lines = append(lines, fmt.Sprintf("%s: %s", call.Tool, out))
+			}
+		}
+		return nil
+	})
+	return strings.Join(lines, "\n"), errstr
+}
@@ -2,56 +2,33 @@ package executor
 
 import (
 	"fmt"
-	"os"
 	"errors"
 	"reflect"
 	"strings"
+	"encoding/json"
 	"autochrome/executor/chrome"
-	"autochrome/executor/symbols"
 	"github.com/traefik/yaegi/interp"
-	"github.com/traefik/yaegi/stdlib"
-	"github.com/traefik/yaegi/stdlib/syscall"
-	"github.com/traefik/yaegi/stdlib/unrestricted"
 )
 
 type Executor struct {
 	Interp  *interp.Interpreter
+	Profile string
+	// Browser of the session, generated code only gets it as a chrome.Browser
+	chrome  *chrome.Chrome
+	browser *chrome.Browser
 }
 
-func NewExecutor() (*Executor, error) {
-	exec := &Executor{}
+func NewExecutor(profile string) (*Executor, error) {
+	exec := &Executor{Profile: profile}
 
 	i := interp.New(interp.Options{
-			Env: os.Environ(),
+			Env: profileEnv(profile),
 	})
-	err := i.Use(stdlib.Symbols)
+	err := useProfile(i, profile)
 	if err != nil {
 		return nil, err
 	}
 
-	err = i.Use(symbols.Symbols)
-	if err != nil {
-		return nil, err
-	}
-
-	err = i.Use(syscall.Symbols)
-	if err != nil {
-		return nil, err
-	}
-
-	if err = os.Setenv("YAEGI_SYSCALL", "1"); err != nil {
-		return nil, err
-	}
-
-	err = i.Use(unrestricted.Symbols)
-	if err != nil {
-		return nil, err
-	}
-
-	if err = os.Setenv("YAEGI_UNRESTRICTED", "1"); err != nil {
-		return nil, err
-	}
-
 	exec.Interp = i
 
 	return exec, nil
@@ -83,16 +60,26 @@ func (d *Executor) safeEval(code string) (res reflect.Value, err error) {
 }
 
 func (d *Executor) ChromeNew() (*chrome.Chrome, error) {
+	d.chrome  = chrome.New()
+	d.browser = chrome.NewBrowser(d.chrome)
+	err := d.Interp.Use(interp.Exports{
+		"autochrome/executor/host/host": {
+			"VarChrome": reflect.ValueOf(&d.browser).Elem(),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
 	code := `
 	import "fmt"
 	import "os"
-	import "os/signal"
-	import "syscall"
 	import "context"
 	import "time"
 	import "github.com/chromedp/chromedp"
 	import "github.com/chromedp/chromedp/kb"
 	import "autochrome/executor/chrome"
+	import "autochrome/executor/host"
 
 	func unused() {
 		fmt.Println(os.Getenv("PATH"))
@@ -100,115 +87,294 @@ func (d *Executor) ChromeNew() (*chrome.Chrome, error) {
 		time.Sleep(1*time.Second)
 	}
 
-	var VarChrome = chrome.New()
+	var VarChrome = host.VarChrome
 	var VarFunc   = func () (func(ctx context.Context) error) {
 		return func(ctx context.Context) error {
 			return nil
 		}
 	}
-
-	var SignalFunc = func () {
-		var sigChan chan os.Signal = make(chan os.Signal, 1)
-		signal.Notify(sigChan, syscall.SIGINT)
-		go func() {
-			for sig := range sigChan {
-				VarChrome.NewTab()
-				VarChrome.NavigateAndWaitReady()
-			}
-		}()
-	}
 	`
-	_, err := d.safeEval(code)
+	_, err = d.safeEval(code)
 	if err != nil {
 		return nil, err
 	}
 
-	_, serr := d.safeEval(fmt.Sprintf(`SignalFunc()`))
-	if serr != nil {
-		return nil, serr
-	}
+	return d.varChrome()
+}
 
-	value, verr := d.safeEval(fmt.Sprintf(`VarChrome`))
-	if verr != nil {
-		return nil, verr
-	}
-	varChrome, ok := value.Interface().(*chrome.Chrome)
-	if !ok {
-		return nil, errors.New("Func 'chrome.New' return type is not '*chrome.Chrome'!")
+func (d *Executor) varChrome() (*chrome.Chrome, error) {
+	if d.chrome == nil {
+		return nil, errors.New("Chrome is not created!")
 	}
-	return varChrome, nil
+	return d.chrome, nil
 }
 
 func (d *Executor) ChromeDelete() error {
-	_, err := d.safeEval(`chrome.Delete(VarChrome)`)
+	varChrome, err := d.varChrome()
 	if err != nil {
 		return err
 	}
+	chrome.Delete(varChrome)
 	return nil
 }
 
 func (d *Executor) ChromeSetSize(width, height int) error {
-	_, err := d.safeEval(fmt.Sprintf(`chrome.SetSize(%d, %d)`, width, height))
+	varChrome, err := d.varChrome()
 	if err != nil {
 		return err
 	}
+	varChrome.SetSize(width, height)
 	return nil
 }
 
 func (d *Executor) ChromeSetUrl(url string) error {
-	_, err := d.safeEval(fmt.Sprintf(`VarChrome.SetUrl("%s")`, url))
+	varChrome, err := d.varChrome()
 	if err != nil {
 		return err
 	}
+	varChrome.SetUrl(url)
 	return nil
 }
 
-func (d *Executor) ChromeGetHtml() (string, error) {
-	value, err := d.safeEval(fmt.Sprintf(`VarChrome.GetHtml()`))
+func (d *Executor) ChromeSetOptions(opts chrome.Options) error {
+	varChrome, err := d.varChrome()
 	if err != nil {
-		return "", err
+		return err
 	}
-	str, ok := value.Interface().(string)
-	if !ok {
-		return "", errors.New("Func 'GetHtml' return type is not 'string'!")
+	varChrome.SetOptions(opts)
+	return nil
+}
+
+func (d *Executor) ChromeSetTimeout(seconds int) error {
+	varChrome, err := d.varChrome()
+	if err != nil {
+		return err
 	}
-	return str, nil
+	varChrome.SetTimeout(seconds)
+	return nil
 }
 
-func (d *Executor) ChromeNewTab() error {
-	_, err := d.safeEval(fmt.Sprintf(`VarChrome.NewTab()`))
+// Directory of screenshots taken by generated code and tools
+func (d *Executor) ChromeSetSaveDir(dir string) error {
+	varChrome, err := d.varChrome()
 	if err != nil {
 		return err
 	}
+	varChrome.SaveDir = dir
 	return nil
 }
 
-func (d *Executor) ChromeNavigateAndWaitReady() error {
-	value, err := d.safeEval(fmt.Sprintf(`VarChrome.NavigateAndWaitReady()`))
+// Closing interrupt cancels the running task, e.g. the client of the request left
+func (d *Executor) ChromeSetInterrupt(interrupt <-chan struct{}) error {
+	varChrome, err := d.varChrome()
 	if err != nil {
 		return err
 	}
-	str, ok := value.Interface().(string)
-	if !ok {
-		return errors.New("Func 'NavigateAndWaitReady' return type is not 'string'!")
+	varChrome.Interrupt = interrupt
+	return nil
+}
+
+func (d *Executor) ChromeGetHtml() (string, error) {
+	varChrome, err := d.varChrome()
+	if err != nil {
+		return "", err
 	}
+	return varChrome.GetHtml(), nil
+}
+
+func (d *Executor) ChromeNewTab() error {
+	varChrome, err := d.varChrome()
+	if err != nil {
+		return err
+	}
+	return errorString(varChrome.NewTab())
+}
+
+func errorString(str string) error {
 	if len(str) > 0 {
 		return errors.New(str)
 	}
 	return nil
 }
 
+func (d *Executor) ChromeGetUrl() (string, error) {
+	varChrome, err := d.varChrome()
+	if err != nil {
+		return "", err
+	}
+	return varChrome.GetUrl(), nil
+}
+
+func (d *Executor) ChromeListTabs() ([]*chrome.Tab, error) {
+	varChrome, err := d.varChrome()
+	if err != nil {
+		return nil, err
+	}
+	return varChrome.ListTabs(), nil
+}
+
+func (d *Executor) ChromeAXNodes() ([]*chrome.AXNode, error) {
+	varChrome, err := d.varChrome()
+	if err != nil {
+		return nil, err
+	}
+	nodes, errstr := varChrome.AXNodes()
+	if len(errstr) > 0 {
+		return nil, errors.New(errstr)
+	}
+	return nodes, nil
+}
+
+func (d *Executor) ChromeElementMap() ([]*chrome.AXNode, error) {
+	varChrome, err := d.varChrome()
+	if err != nil {
+		return nil, err
+	}
+	nodes, errstr := varChrome.ElementMap()
+	if len(errstr) > 0 {
+		return nil, errors.New(errstr)
+	}
+	return nodes, nil
+}
+
+// Tools run natively, not by the interpreter
+func (d *Executor) ChromeRunTools(calls []*chrome.ToolCall) (string, error) {
+	varChrome, err := d.varChrome()
+	if err != nil {
+		return "", err
+	}
+	out, errstr := varChrome.RunTools(calls)
+	if errstr == chrome.ErrTimeout.Error() {
+		return out, chrome.ErrTimeout
+	} else if errstr == chrome.ErrCanceled.Error() {
+		return out, chrome.ErrCanceled
+	} else if len(errstr) > 0 {
+		return out, errors.New(errstr)
+	}
+	return out, nil
+}
+
+// Elements by ref and selector, for the risk of an action
+func (d *Executor) ChromeTargetInfos(refs []int, selectors []string) ([]*chrome.TargetInfo, error) {
+	varChrome, err := d.varChrome()
+	if err != nil {
+		return nil, err
+	}
+	infos, errstr := varChrome.TargetInfos(refs, selectors)
+	if len(errstr) > 0 {
+		return infos, errors.New(errstr)
+	}
+	return infos, nil
+}
+
+// Hosts the browser may request, must be set before the first tab
+func (d *Executor) ChromeSetHostGuard(guard func(host string) bool) error {
+	varChrome, err := d.varChrome()
+	if err != nil {
+		return err
+	}
+	varChrome.HostGuard = guard
+	return nil
+}
+
+// Requests failed by the host guard since the last call
+func (d *Executor) ChromeTakeBlocked() ([]*chrome.BlockedRequest, error) {
+	varChrome, err := d.varChrome()
+	if err != nil {
+		return nil, err
+	}
+	return varChrome.TakeBlocked(), nil
+}
+
+// Rows of chrome.Emit since the last call
+func (d *Executor) ChromeTakeEmitted() ([]json.RawMessage, error) {
+	varChrome, err := d.varChrome()
+	if err != nil {
+		return nil, err
+	}
+	return varChrome.TakeEmitted(), nil
+}
+
+func (d *Executor) ChromeActiveTab() (int, error) {
+	varChrome, err := d.varChrome()
+	if err != nil {
+		return -1, err
+	}
+	return varChrome.Active, nil
+}
+
+func (d *Executor) ChromeOpenTab(url string) error {
+	varChrome, err := d.varChrome()
+	if err != nil {
+		return err
+	}
+	return errorString(varChrome.OpenTab(url))
+}
+
+func (d *Executor) ChromeSwitchTab(index int) error {
+	varChrome, err := d.varChrome()
+	if err != nil {
+		return err
+	}
+	return errorString(varChrome.SwitchTab(index))
+}
+
+func (d *Executor) ChromeCloseTab(index int) error {
+	varChrome, err := d.varChrome()
+	if err != nil {
+		return err
+	}
+	return errorString(varChrome.CloseTab(index))
+}
+
+// Path is chosen by the user, not by generated code
+func (d *Executor) ChromeScreenshot(path string) error {
+	varChrome, err := d.varChrome()
+	if err != nil {
+		return err
+	}
+	return errorString(varChrome.Screenshot(path))
+}
+
+func (d *Executor) ChromeScreenshotElement(path string, selector string) error {
+	varChrome, err := d.varChrome()
+	if err != nil {
+		return err
+	}
+	return errorString(varChrome.ScreenshotElement(path, selector))
+}
+
+func (d *Executor) ChromeNavigateAndWaitReady() error {
+	varChrome, err := d.varChrome()
+	if err != nil {
+		return err
+	}
+	return errorString(varChrome.NavigateAndWaitReady())
+}
+
 func (d *Executor) ChromeRunTasks(code string) error {
+	imports, body, ierr := d.splitImports(code)
+	if ierr != nil {
+		return ierr
+	}
+
+	for _, imp := range imports {
+		_, err := d.safeEval(imp)
+		if err != nil {
+			return d.profileError(err)
+		}
+	}
+
 	_, aerr := d.safeEval(fmt.Sprintf(`
 		VarFunc = func () (func(ctx context.Context) error) {
 			return func(ctx context.Context) error {
 				%s
 			}
 		}
-	`, code))
+	`, body))
 
 	if aerr != nil {
-		return aerr
+		return d.profileError(aerr)
 	}
 
 	value, berr := d.safeEval(fmt.Sprintf(`VarChrome.RunTasks(VarFunc())`))
@@ -222,6 +388,14 @@ func (d *Executor) ChromeRunTasks(code string) error {
 		return errors.New("Func 'RunTasks' return type is not 'string'!")
 	}
 
+	if str == chrome.ErrTimeout.Error() {
+		return chrome.ErrTimeout
+	}
+
+	if str == chrome.ErrCanceled.Error() {
+		return chrome.ErrCanceled
+	}
+
 	if len(str) > 0 {
 		return errors.New(str)
 	}
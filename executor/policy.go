@@ -0,0 +1,269 @@
+package executor
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+)
+
+type Policy struct {
+	ForbiddenPackages []string
+	ForbiddenIdents   []string
+	AllowDomains      []string
+	DenyDomains       []string
+}
+
+func NewPolicy() *Policy {
+	return &Policy{
+		ForbiddenPackages: []string{
+			"net",
+			"net/http",
+			"os/exec",
+			"os/signal",
+			"plugin",
+			"syscall",
+			"unsafe",
+		},
+		// Package path and name, e.g. 'os/exec.Command'
+		ForbiddenIdents: []string{
+			"io/ioutil.TempDir",
+			"io/ioutil.TempFile",
+			"io/ioutil.WriteFile",
+			"os/exec.Command",
+			"os/exec.CommandContext",
+			"os.Chmod",
+			"os.Chown",
+			"os.Chtimes",
+			"os.Clearenv",
+			"os.CopyFS",
+			"os.Create",
+			"os.CreateTemp",
+			"os.Exit",
+			"os.Lchown",
+			"os.Link",
+			"os.Mkdir",
+			"os.MkdirAll",
+			"os.MkdirTemp",
+			"os.NewFile",
+			"os.OpenFile",
+			"os.Remove",
+			"os.RemoveAll",
+			"os.Rename",
+			"os.Setenv",
+			"os.StartProcess",
+			"os.Symlink",
+			"os.Truncate",
+			"os.Unsetenv",
+			"os.WriteFile",
+			"syscall.Exec",
+			"syscall.Kill",
+		},
+	}
+}
+
+func contains(list []string, str string) bool {
+	for _, s := range list {
+		if s == str {
+			return true
+		}
+	}
+	return false
+}
+
+func MatchDomain(host string, domains []string) bool {
+	host = strings.ToLower(host)
+	for _, d := range domains {
+		d = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(d), "."))
+		if len(d) <= 0 {
+			continue
+		}
+		if host == d || strings.HasSuffix(host, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Policy) IsAllowedHost(host string) bool {
+	if MatchDomain(host, p.DenyDomains) {
+		return false
+	}
+	if len(p.AllowDomains) > 0 {
+		return MatchDomain(host, p.AllowDomains)
+	}
+	return true
+}
+
+func (p *Policy) IsAllowedUrl(rawurl string) bool {
+	u, err := url.Parse(rawurl)
+	if err != nil || len(u.Hostname()) <= 0 {
+		// Relative url stays on the current site
+		return true
+	}
+	return p.IsAllowedHost(u.Hostname())
+}
+
+// Check code block before it runs, return the violations found
+func (p *Policy) Check(code string) []string {
+	var violations []string
+
+	imports, body := SplitImports(code)
+	header := "package main\n" + strings.Join(imports, "\n") + "\nfunc _(ctx context.Context) error {\n"
+	offset := strings.Count(header, "\n")
+
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", header+body+"\n}\n", 0)
+	if err != nil {
+		// Code which can not be checked does not run
+		if list, ok := err.(scanner.ErrorList); ok && len(list) > 0 {
+			return append(violations, fmt.Sprintf("Line %d: Syntax error, %s!", list[0].Pos.Line - offset, list[0].Msg))
+		}
+		return append(violations, fmt.Sprintf("Syntax error, %s!", err))
+	}
+
+	line := func(node ast.Node) int {
+		return fset.Position(node.Pos()).Line - offset
+	}
+
+	names := packageNames(file)
+	for _, imp := range file.Imports {
+		pkg, _ := strconv.Unquote(imp.Path.Value)
+		name := path.Base(pkg)
+		if imp.Name != nil {
+			name = imp.Name.Name
+		}
+		if contains(p.ForbiddenPackages, pkg) {
+			violations = append(violations, fmt.Sprintf("Import of package '%s' is forbidden!", pkg))
+		} else if name == "." {
+			// Its identifiers could not be told from local ones
+			violations = append(violations, fmt.Sprintf("Dot import of package '%s' is forbidden!", pkg))
+		}
+	}
+
+	pkgOf := func(x *ast.Ident) string {
+		return packageOf(names, x)
+	}
+
+	ast.Inspect(file, func(node ast.Node) bool {
+		switch n := node.(type) {
+		case *ast.SelectorExpr:
+			x, ok := n.X.(*ast.Ident)
+			if !ok {
+				break
+			}
+			ident := x.Name + "." + n.Sel.Name
+			pkg := pkgOf(x)
+			if contains(p.ForbiddenIdents, pkg + "." + n.Sel.Name) {
+				violations = append(violations, fmt.Sprintf("Line %d: '%s' of package '%s' is forbidden!", line(n), ident, pkg))
+			} else if contains(p.ForbiddenPackages, pkg) {
+				violations = append(violations, fmt.Sprintf("Line %d: '%s' of package '%s' is forbidden!", line(n), ident, pkg))
+			}
+		case *ast.ForStmt:
+			if n.Cond == nil && !checksContext(n.Body) {
+				violations = append(violations, fmt.Sprintf("Line %d: Infinite 'for' loop must check 'ctx.Done()' or 'ctx.Err()'!", line(n)))
+			}
+		case *ast.CallExpr:
+			sel, ok := n.Fun.(*ast.SelectorExpr)
+			if !ok || len(n.Args) <= 0 {
+				break
+			}
+			x, ok := sel.X.(*ast.Ident)
+			if !ok || pkgOf(x) != "github.com/chromedp/chromedp" || sel.Sel.Name != "Navigate" {
+				break
+			}
+			rawurl, ok := constString(n.Args[0])
+			if !ok {
+				// Without domain lists any url is allowed
+				if len(p.AllowDomains) > 0 || len(p.DenyDomains) > 0 {
+					violations = append(violations, fmt.Sprintf("Line %d: Navigation target must be a string literal under the domain policy!", line(n)))
+				}
+				break
+			}
+			if !p.IsAllowedUrl(rawurl) {
+				violations = append(violations, fmt.Sprintf("Line %d: Navigation to '%s' is not allowed!", line(n), rawurl))
+			}
+		}
+		return true
+	})
+
+	return violations
+}
+
+// Value of a string literal, or of literals joined by '+'
+func constString(expr ast.Expr) (string, bool) {
+	switch e := expr.(type) {
+	case *ast.BasicLit:
+		if e.Kind != token.STRING {
+			return "", false
+		}
+		str, err := strconv.Unquote(e.Value)
+		return str, err == nil
+	case *ast.ParenExpr:
+		return constString(e.X)
+	case *ast.BinaryExpr:
+		if e.Op != token.ADD {
+			return "", false
+		}
+		x, ok := constString(e.X)
+		if !ok {
+			return "", false
+		}
+		y, ok := constString(e.Y)
+		return x + y, ok
+	}
+	return "", false
+}
+
+// Package paths by the names code refers to them, with the packages imported by main.go
+func packageNames(file *ast.File) map[string]string {
+	names := map[string]string{
+		"chrome"   : "autochrome/executor/chrome",
+		"chromedp" : "github.com/chromedp/chromedp",
+		"kb"       : "github.com/chromedp/chromedp/kb",
+	}
+	for _, imp := range file.Imports {
+		pkg, _ := strconv.Unquote(imp.Path.Value)
+		name := path.Base(pkg)
+		if imp.Name != nil {
+			name = imp.Name.Name
+		}
+		names[name] = pkg
+	}
+	return names
+}
+
+// Path of the package a selector refers to
+func packageOf(names map[string]string, x *ast.Ident) string {
+	if pkg, ok := names[x.Name]; ok {
+		return pkg
+	}
+	return x.Name
+}
+
+func isCall(call *ast.CallExpr, pkg, fun string) bool {
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok {
+		return false
+	}
+	x, ok := sel.X.(*ast.Ident)
+	return ok && x.Name == pkg && sel.Sel.Name == fun
+}
+
+func checksContext(body *ast.BlockStmt) bool {
+	found := false
+	ast.Inspect(body, func(node ast.Node) bool {
+		if call, ok := node.(*ast.CallExpr); ok {
+			if isCall(call, "ctx", "Done") || isCall(call, "ctx", "Err") {
+				found = true
+			}
+		}
+		return !found
+	})
+	return found
+}
@@ -0,0 +1,77 @@
+package executor
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPolicyCheck(t *testing.T) {
+	p := NewPolicy()
+	p.AllowDomains = []string{"example.com"}
+	tests := []struct {
+		name string
+		code string
+		// Part of a violation, empty if the code is allowed
+		want string
+	}{
+		{"click", `chromedp.Run(ctx, chromedp.Click("#ok"))`, ""},
+		{"forbidden package", "import \"os/exec\"\nexec.Command(\"ls\").Run()", "Import of package 'os/exec'"},
+		{"aliased package", "import run \"os/exec\"\nrun.Command(\"ls\").Run()", "Import of package 'os/exec'"},
+		{"remove", "import \"os\"\nos.RemoveAll(\"/\")", "'os.RemoveAll'"},
+		{"aliased remove", "import files \"os\"\nfiles.RemoveAll(\"/\")", "'files.RemoveAll' of package 'os'"},
+		{"truncate", "import \"os\"\nos.Truncate(\"a\", 0)", "'os.Truncate'"},
+		{"symlink", "import \"os\"\nos.Symlink(\"a\", \"b\")", "'os.Symlink'"},
+		{"ioutil", "import \"io/ioutil\"\nioutil.WriteFile(\"a\", nil, 0644)", "'ioutil.WriteFile'"},
+		{"local os", "os := struct{ Getenv func(string) string }{}\n_ = os", ""},
+		{"getenv", "import \"os\"\n_ = os.Getenv(\"PATH\")", ""},
+		{"dot import", "import . \"os\"\nRemoveAll(\"/\")", "Dot import of package 'os'"},
+		{"syntax error", "chromedp.Run(ctx,", "Line 2: Syntax error"},
+		{"infinite loop", "for {\n}", "Line 1: Infinite 'for' loop"},
+		{"loop checks ctx", "for {\nif ctx.Err() != nil {\nbreak\n}\n}", ""},
+		{"allowed url", `chromedp.Run(ctx, chromedp.Navigate("https://www.example.com/a"))`, ""},
+		{"relative url", `chromedp.Run(ctx, chromedp.Navigate("/login"))`, ""},
+		{"denied url", `chromedp.Run(ctx, chromedp.Navigate("https://evil.com/"))`, "Navigation to 'https://evil.com/'"},
+		{"joined url", `chromedp.Run(ctx, chromedp.Navigate("https://evil" + ".com/"))`, "Navigation to 'https://evil.com/'"},
+		{"aliased chromedp", "import cdp \"github.com/chromedp/chromedp\"\ncdp.Run(ctx, cdp.Navigate(\"https://evil.com/\"))", "Navigation to 'https://evil.com/'"},
+		{"variable url", "u := \"https://evil.com/\"\nchromedp.Run(ctx, chromedp.Navigate(u))", "must be a string literal"},
+	}
+	for _, tt := range tests {
+		violations := p.Check(tt.code)
+		if len(tt.want) <= 0 {
+			if len(violations) > 0 {
+				t.Errorf("%s: violations %v, want none", tt.name, violations)
+			}
+			continue
+		}
+		if !strings.Contains(strings.Join(violations, "\n"), tt.want) {
+			t.Errorf("%s: violations %v, want one with %q", tt.name, violations, tt.want)
+		}
+	}
+}
+
+func TestPolicyVariableUrlWithoutDomains(t *testing.T) {
+	violations := NewPolicy().Check("u := \"https://evil.com/\"\nchromedp.Run(ctx, chromedp.Navigate(u))")
+	if len(violations) > 0 {
+		t.Errorf("violations %v, want none without domain lists", violations)
+	}
+}
+
+func TestIsAllowedHost(t *testing.T) {
+	p := &Policy{AllowDomains: []string{".example.com"}, DenyDomains: []string{"admin.example.com"}}
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{"example.com", true},
+		{"WWW.Example.com", true},
+		{"admin.example.com", false},
+		{"a.admin.example.com", false},
+		{"badexample.com", false},
+		{"example.com.evil.com", false},
+	}
+	for _, tt := range tests {
+		if got := p.IsAllowedHost(tt.host); got != tt.want {
+			t.Errorf("IsAllowedHost(%q) = %v, want %v", tt.host, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,273 @@
+package executor
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"autochrome/executor/symbols"
+	"github.com/traefik/yaegi/interp"
+	"github.com/traefik/yaegi/stdlib"
+	"github.com/traefik/yaegi/stdlib/syscall"
+	"github.com/traefik/yaegi/stdlib/unrestricted"
+)
+
+const (
+	ProfileStrict       = "strict"
+	ProfileStandard     = "standard"
+	ProfileUnrestricted = "unrestricted"
+)
+
+// Stdlib packages visible to generated code in strict profile
+var strictStdlib = []string{
+	"context/context",
+	"errors/errors",
+	"fmt/fmt",
+	"strconv/strconv",
+	"strings/strings",
+	"time/time",
+}
+
+// Environment variables os.Getenv can read except in unrestricted profile, others read as empty
+var strictEnv = []string{
+	"LANG",
+	"LC_ALL",
+	"PATH",
+	"TZ",
+}
+
+// Symbols of autochrome which reach the browser options, the host guard or the vault, hidden in every profile
+var hostDenied = map[string][]string{
+	"autochrome/executor/chrome/chrome": {
+		"Chrome",
+		"Delete",
+		"New",
+		"NewBrowser",
+		"Options",
+		"SetSecrets",
+	},
+}
+
+// Symbols which could start a process, hidden in strict profile
+var strictDenied = map[string][]string{
+	"github.com/chromedp/chromedp/chromedp": {
+		"CombinedOutput",
+		"ExecPath",
+		"ModifyCmdFunc",
+		"NewExecAllocator",
+		"UserDataDir",
+	},
+}
+
+func strictGetenv(key string) string {
+	for _, name := range strictEnv {
+		if name == key {
+			return os.Getenv(key)
+		}
+	}
+	return ""
+}
+
+// Environment of the interpreter, keys and passphrases of autochrome stay out of generated code
+func profileEnv(profile string) []string {
+	if profile == ProfileUnrestricted {
+		return os.Environ()
+	}
+	var env []string
+	for _, name := range strictEnv {
+		if value, ok := os.LookupEnv(name); ok {
+			env = append(env, name+"="+value)
+		}
+	}
+	return env
+}
+
+var importPattern = regexp.MustCompile(`(?m)^[ \t]*import[ \t]+(?:[\w.]+[ \t]+)?"([^"]+)"[ \t]*;?[ \t]*$`)
+var missingPackagePattern = regexp.MustCompile(`unable to find source related to: "([^"]+)"`)
+var missingSymbolPattern = regexp.MustCompile(`package \w+ "([^"]+)" has no symbol (\w+)`)
+
+type ProfileError struct {
+	Profile string
+	Package string
+}
+
+func (e *ProfileError) Error() string {
+	return fmt.Sprintf("Package '%s' is not allowed by executor profile '%s'!", e.Package, e.Profile)
+}
+
+func IsValidProfile(profile string) bool {
+	if profile == ProfileStrict || profile == ProfileStandard || profile == ProfileUnrestricted {
+		return true
+	}
+	return false
+}
+
+func useProfile(i *interp.Interpreter, profile string) error {
+	switch profile {
+	case ProfileStrict:
+		return useStrict(i)
+	case ProfileStandard:
+		return useStandard(i)
+	case ProfileUnrestricted:
+		return useUnrestricted(i)
+	}
+	return fmt.Errorf("Unknown executor profile '%s'!", profile)
+}
+
+// Symbols of chromedp and autochrome without the denied ones
+func allowedSymbols(denied ...map[string][]string) interp.Exports {
+	exports := interp.Exports{}
+	for pkg, syms := range symbols.Symbols {
+		allowed := map[string]reflect.Value{}
+		for name, sym := range syms {
+			allowed[name] = sym
+		}
+		for _, d := range denied {
+			for _, name := range d[pkg] {
+				delete(allowed, name)
+			}
+		}
+		exports[pkg] = allowed
+	}
+	return exports
+}
+
+func useStandard(i *interp.Interpreter) error {
+	err := i.Use(stdlib.Symbols)
+	if err != nil {
+		return err
+	}
+	return i.Use(allowedSymbols(hostDenied))
+}
+
+func useUnrestricted(i *interp.Interpreter) error {
+	err := useStandard(i)
+	if err != nil {
+		return err
+	}
+
+	err = i.Use(syscall.Symbols)
+	if err != nil {
+		return err
+	}
+
+	if err = os.Setenv("YAEGI_SYSCALL", "1"); err != nil {
+		return err
+	}
+
+	err = i.Use(unrestricted.Symbols)
+	if err != nil {
+		return err
+	}
+
+	if err = os.Setenv("YAEGI_UNRESTRICTED", "1"); err != nil {
+		return err
+	}
+	return nil
+}
+
+func useStrict(i *interp.Interpreter) error {
+	exports := allowedSymbols(hostDenied, strictDenied)
+	for _, pkg := range strictStdlib {
+		exports[pkg] = stdlib.Symbols[pkg]
+	}
+	err := i.Use(exports)
+	if err != nil {
+		return err
+	}
+
+	// Only os.Getenv, used separately so yaegi does not add the rest of 'os'
+	return i.Use(interp.Exports{
+		"os/os": {
+			"Getenv": reflect.ValueOf(strictGetenv),
+		},
+	})
+}
+
+// Compile a standalone program without running it, e.g. an exported session
+func CheckProgram(src string) (err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("%v", e)
+		}
+	}()
+	i := interp.New(interp.Options{})
+	err = useStandard(i)
+	if err != nil {
+		return err
+	}
+	_, err = i.Compile(src)
+	return err
+}
+
+func (d *Executor) isAllowedImport(importPath string) bool {
+	if d.Profile != ProfileStrict {
+		return true
+	}
+	key := importPath + "/" + path.Base(importPath)
+	if key == "os/os" {
+		return true
+	}
+	for _, pkg := range strictStdlib {
+		if pkg == key {
+			return true
+		}
+	}
+	_, ok := symbols.Symbols[key]
+	return ok
+}
+
+func (d *Executor) AllowedPackages() string {
+	var pkgs []string
+	if d.Profile == ProfileStrict {
+		for _, pkg := range strictStdlib {
+			pkgs = append(pkgs, path.Dir(pkg))
+		}
+		pkgs = append(pkgs, fmt.Sprintf("os (Getenv of %s)", strings.Join(strictEnv, ", ")))
+	} else {
+		pkgs = append(pkgs, "stdlib")
+	}
+	for pkg := range symbols.Symbols {
+		pkgs = append(pkgs, path.Dir(pkg))
+	}
+	sort.Strings(pkgs)
+	return strings.Join(pkgs, ", ")
+}
+
+// Split import lines from a code block
+func SplitImports(code string) (imports []string, body string) {
+	imports = importPattern.FindAllString(code, -1)
+	body = importPattern.ReplaceAllString(code, "")
+	return imports, body
+}
+
+// Split import lines from a code block, check them against the profile
+func (d *Executor) splitImports(code string) (imports []string, body string, err error) {
+	for _, match := range importPattern.FindAllStringSubmatch(code, -1) {
+		if !d.isAllowedImport(match[1]) {
+			return nil, code, &ProfileError{Profile: d.Profile, Package: match[1]}
+		}
+		imports = append(imports, strings.TrimSpace(match[0]))
+	}
+	body = importPattern.ReplaceAllString(code, "")
+	return imports, body, nil
+}
+
+// Make yaegi's missing package error readable for the agent
+func (d *Executor) profileError(err error) error {
+	if err == nil {
+		return nil
+	}
+	match := missingPackagePattern.FindStringSubmatch(err.Error())
+	if match != nil {
+		return &ProfileError{Profile: d.Profile, Package: match[1]}
+	}
+	match = missingSymbolPattern.FindStringSubmatch(err.Error())
+	if match != nil && (d.Profile == ProfileStrict || contains(hostDenied[match[1]+"/"+path.Base(match[1])], match[2])) {
+		return &ProfileError{Profile: d.Profile, Package: match[1] + "." + match[2]}
+	}
+	return err
+}
@@ -0,0 +1,109 @@
+package executor
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestDeniedSymbols(t *testing.T) {
+	host := []string{
+		"chrome.Chrome",
+		"chrome.Delete",
+		"chrome.New",
+		"chrome.NewBrowser",
+		"chrome.Options",
+		"chrome.SetSecrets",
+	}
+	process := []string{
+		"chromedp.CombinedOutput",
+		"chromedp.ExecPath",
+		"chromedp.ModifyCmdFunc",
+		"chromedp.NewExecAllocator",
+		"chromedp.UserDataDir",
+	}
+	tests := []struct {
+		profile string
+		denied  []string
+	}{
+		{ProfileStrict, append(host, process...)},
+		{ProfileStandard, host},
+		{ProfileUnrestricted, host},
+	}
+	imports := map[string]string{
+		"chrome":   "autochrome/executor/chrome",
+		"chromedp": "github.com/chromedp/chromedp",
+	}
+	for _, tt := range tests {
+		for _, ident := range tt.denied {
+			// An interpreter imports a package once
+			d, err := NewExecutor(tt.profile)
+			if err != nil {
+				t.Fatalf("NewExecutor(%s): %s", tt.profile, err)
+			}
+			pkg, name, _ := strings.Cut(ident, ".")
+			src := fmt.Sprintf("package main\nimport %q\nvar _ = %s\n", imports[pkg], ident)
+			_, err = d.Interp.Compile(src)
+			if err == nil || !strings.Contains(err.Error(), "has no symbol "+name) && !strings.Contains(err.Error(), "undefined selector") {
+				t.Errorf("%s: %s can be resolved, error %v", tt.profile, ident, err)
+			}
+		}
+	}
+}
+
+func TestAllowedSymbols(t *testing.T) {
+	for _, profile := range []string{ProfileStrict, ProfileStandard} {
+		d, err := NewExecutor(profile)
+		if err != nil {
+			t.Fatalf("NewExecutor(%s): %s", profile, err)
+		}
+		src := "package main\nimport \"autochrome/executor/chrome\"\nvar _ = chrome.ClickRef\nvar _ *chrome.Browser\n"
+		if _, err = d.Interp.Compile(src); err != nil {
+			t.Errorf("%s: %s", profile, err)
+		}
+	}
+}
+
+func TestProfileError(t *testing.T) {
+	d := &Executor{Profile: ProfileStandard}
+	err := d.profileError(fmt.Errorf(`1:1: package chrome "autochrome/executor/chrome" has no symbol New`))
+	if _, ok := err.(*ProfileError); !ok {
+		t.Errorf("profileError of a denied symbol: %v", err)
+	}
+	err = d.profileError(fmt.Errorf(`1:1: package chrome "autochrome/executor/chrome" has no symbol Nwe`))
+	if _, ok := err.(*ProfileError); ok {
+		t.Errorf("profileError of a typo: %v", err)
+	}
+}
+
+func TestProfileEnv(t *testing.T) {
+	t.Setenv("VAULT_PASSPHRASE", "secret passphrase")
+	t.Setenv("TZ", "UTC")
+	tests := []struct {
+		profile string
+		key     string
+		want    string
+	}{
+		{ProfileStrict, "VAULT_PASSPHRASE", ""},
+		{ProfileStrict, "TZ", "UTC"},
+		{ProfileStandard, "VAULT_PASSPHRASE", ""},
+		{ProfileStandard, "TZ", "UTC"},
+		{ProfileUnrestricted, "VAULT_PASSPHRASE", "secret passphrase"},
+	}
+	for _, tt := range tests {
+		d, err := NewExecutor(tt.profile)
+		if err != nil {
+			t.Fatalf("NewExecutor(%s): %s", tt.profile, err)
+		}
+		if _, err = d.Interp.Eval(`import "os"`); err != nil {
+			t.Fatalf("%s: %s", tt.profile, err)
+		}
+		res, err := d.Interp.Eval(fmt.Sprintf("os.Getenv(%q)", tt.key))
+		if err != nil {
+			t.Fatalf("%s: %s", tt.profile, err)
+		}
+		if got := res.String(); got != tt.want {
+			t.Errorf("%s: os.Getenv(%q) = %q, want %q", tt.profile, tt.key, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package executor
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"strconv"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"autochrome/executor/chrome"
+)
+
+// Words of things hard to undo: deleting, paying, sending
+var riskWords = regexp.MustCompile(`(?i)\b(delete|remove|destroy|pay|payment|purchase|buy|checkout|place order|send|transfer|unsubscribe|cancel subscription)\b|删除|移除|注销|支付|付款|购买|下单|结算|发送|转账|退订`)
+
+var sensitiveFields = regexp.MustCompile(`(?i)password|\bcc-|card|cvv|cvc|expir|卡号|密码`)
+
+// Scripts which act on the page instead of reading it
+var actingScript = regexp.MustCompile(`(?i)\.(click|submit|requestSubmit|dispatchEvent|remove)\s*\(|\.value\s*=[^=]|\b(fetch|XMLHttpRequest|sendBeacon)\b|location(\.href)?\s*=[^=]`)
+
+// Element and selector arguments of the calls of chromedp and chrome, by package path
+var targetCalls = map[string]bool{
+	"github.com/chromedp/chromedp.Click":       true,
+	"github.com/chromedp/chromedp.DoubleClick": true,
+	"github.com/chromedp/chromedp.Submit":      true,
+	"github.com/chromedp/chromedp.SendKeys":    true,
+	"github.com/chromedp/chromedp.SetValue":    true,
+	"autochrome/executor/chrome.ClickRef":      false,
+	"autochrome/executor/chrome.TypeRef":       false,
+}
+
+// What the code acts on, only literals are known before it runs
+type ActionTarget struct {
+	Refs      []int
+	Selectors []string
+	// Submits a form, by chromedp.Submit or the Enter key
+	Submits   bool
+	// Risk words in the strings of the code, e.g. a selector kept in a variable
+	Words     []string
+	// Scripts acting on the page, and code which does not parse, anything may happen
+	Scripts   []string
+	// Calls whose target is kept in a variable
+	Variables []string
+}
+
+func isEnter(names map[string]string, expr ast.Expr) bool {
+	switch e := expr.(type) {
+	case *ast.BasicLit:
+		str, _ := strconv.Unquote(e.Value)
+		return e.Kind == token.STRING && strings.ContainsAny(str, "\r\n")
+	case *ast.SelectorExpr:
+		x, ok := e.X.(*ast.Ident)
+		return ok && packageOf(names, x) == "github.com/chromedp/chromedp/kb" && e.Sel.Name == "Enter"
+	case *ast.BinaryExpr:
+		return isEnter(names, e.X) || isEnter(names, e.Y)
+	}
+	return false
+}
+
+// Targets of the code, aliased imports are resolved
+func ActionTargets(code string) *ActionTarget {
+	target := &ActionTarget{}
+	imports, body := SplitImports(code)
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", "package main\n"+strings.Join(imports, "\n")+"\nfunc _() {\n"+body+"\n}\n", 0)
+	if err != nil {
+		target.Scripts = append(target.Scripts, "code which does not parse")
+		return target
+	}
+	names := packageNames(file)
+	ast.Inspect(file, func(node ast.Node) bool {
+		if lit, ok := node.(*ast.BasicLit); ok && lit.Kind == token.STRING {
+			str, _ := strconv.Unquote(lit.Value)
+			if word := riskWords.FindString(str); len(word) > 0 {
+				target.Words = append(target.Words, word)
+			}
+			return true
+		}
+		call, ok := node.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		x, ok := sel.X.(*ast.Ident)
+		if !ok {
+			return true
+		}
+		name := packageOf(names, x) + "." + sel.Sel.Name
+		if strings.HasPrefix(name, "github.com/chromedp/chromedp.Evaluate") {
+			var lit *ast.BasicLit
+			if len(call.Args) > 0 {
+				lit, _ = call.Args[0].(*ast.BasicLit)
+			}
+			if lit == nil || lit.Kind != token.STRING {
+				target.Scripts = append(target.Scripts, fmt.Sprintf("%s of a script built at run time", sel.Sel.Name))
+			} else if str, _ := strconv.Unquote(lit.Value); actingScript.MatchString(str) {
+				target.Scripts = append(target.Scripts, fmt.Sprintf("%s of '%s'", sel.Sel.Name, actingScript.FindString(str)))
+			}
+			return true
+		}
+		if name == "github.com/chromedp/chromedp.KeyEvent" || name == "github.com/chromedp/chromedp.SendKeys" {
+			for _, arg := range call.Args {
+				if isEnter(names, arg) {
+					target.Submits = true
+				}
+			}
+		}
+		bySelector, ok := targetCalls[name]
+		if !ok {
+			return true
+		}
+		if name == "github.com/chromedp/chromedp.Submit" {
+			target.Submits = true
+		}
+		arg := 0
+		if !bySelector {
+			// After ctx
+			arg = 1
+		}
+		if len(call.Args) <= arg {
+			return true
+		}
+		lit, ok := call.Args[arg].(*ast.BasicLit)
+		if !ok {
+			target.Variables = append(target.Variables, fmt.Sprintf("%s of a target kept in a variable", sel.Sel.Name))
+			return true
+		}
+		if bySelector && lit.Kind == token.STRING {
+			str, _ := strconv.Unquote(lit.Value)
+			target.Selectors = append(target.Selectors, str)
+		} else if !bySelector && lit.Kind == token.INT {
+			ref, _ := strconv.Atoi(lit.Value)
+			target.Refs = append(target.Refs, ref)
+		}
+		return true
+	})
+	return target
+}
+
+// Risk word of a selector or text, empty if there is none
+func RiskWord(str string) string {
+	return riskWords.FindString(str)
+}
+
+func targetName(info *chrome.TargetInfo) string {
+	if info.Ref > 0 {
+		return fmt.Sprintf("[%d]", info.Ref)
+	}
+	return fmt.Sprintf("'%s'", info.Selector)
+}
+
+// Reasons the action is high risk, empty for low risk actions like clicks on links and scrolls
+func ClassifyRisk(target *ActionTarget, infos []*chrome.TargetInfo) []string {
+	var reasons []string
+	for _, word := range target.Words {
+		reasons = append(reasons, fmt.Sprintf("Code mentions '%s'", word))
+	}
+	for _, info := range infos {
+		name := targetName(info)
+		if word := riskWords.FindString(info.Text); len(word) > 0 {
+			reasons = append(reasons, fmt.Sprintf("Element %s says '%s'", name, strings.TrimSpace(info.Text)))
+		}
+		if sensitiveFields.MatchString(info.Type) || sensitiveFields.MatchString(strings.Join(info.FormFields, "\n")) {
+			reasons = append(reasons, fmt.Sprintf("Element %s is in a form with password or card fields", name))
+		}
+	}
+	for _, script := range target.Scripts {
+		reasons = append(reasons, fmt.Sprintf("Code runs %s", script))
+	}
+	if target.Submits {
+		// The form submitted can not be told
+		for _, variable := range target.Variables {
+			reasons = append(reasons, fmt.Sprintf("Code submits and runs %s", variable))
+		}
+		if len(infos) <= 0 && len(target.Variables) <= 0 {
+			reasons = append(reasons, "Code submits a form not found on the page")
+		}
+	}
+	return reasons
+}
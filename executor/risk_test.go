@@ -0,0 +1,88 @@
+package executor
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"autochrome/executor/chrome"
+)
+
+func TestActionTargets(t *testing.T) {
+	tests := []struct {
+		name string
+		code string
+		want ActionTarget
+	}{
+		{"click selector", `chromedp.Run(ctx, chromedp.Click("#buy-now"))`,
+			ActionTarget{Selectors: []string{"#buy-now"}, Words: []string{"buy"}}},
+		{"click ref", `chrome.ClickRef(ctx, 12)`,
+			ActionTarget{Refs: []int{12}}},
+		{"aliased", "import cdp \"github.com/chromedp/chromedp\"\ncdp.Run(ctx, cdp.Click(\"#ok\"))",
+			ActionTarget{Selectors: []string{"#ok"}}},
+		{"submit", `chromedp.Run(ctx, chromedp.Submit("form#pay"))`,
+			ActionTarget{Selectors: []string{"form#pay"}, Submits: true, Words: []string{"pay"}}},
+		{"enter key", `chromedp.Run(ctx, chromedp.SendKeys("#q", "hello"+kb.Enter))`,
+			ActionTarget{Selectors: []string{"#q"}, Submits: true}},
+		{"newline", `chromedp.Run(ctx, chromedp.KeyEvent("\n"))`,
+			ActionTarget{Submits: true}},
+		{"variable target", "sel := \"#x\"\nchromedp.Run(ctx, chromedp.Click(sel))",
+			ActionTarget{Variables: []string{"Click of a target kept in a variable"}}},
+		{"acting script", "chromedp.Run(ctx, chromedp.Evaluate(`document.querySelector('#x').click()`, nil))",
+			ActionTarget{Scripts: []string{"Evaluate of '.click('"}}},
+		{"reading script", "chromedp.Run(ctx, chromedp.Evaluate(`document.title`, nil))",
+			ActionTarget{}},
+		{"built script", "js := \"x\"\nchromedp.Run(ctx, chromedp.Evaluate(js, nil))",
+			ActionTarget{Scripts: []string{"Evaluate of a script built at run time"}}},
+		{"risk word", `chromedp.Run(ctx, chromedp.WaitVisible("Delete account"))`,
+			ActionTarget{Words: []string{"Delete"}}},
+		{"chinese risk word", `chromedp.Run(ctx, chromedp.WaitVisible("确认支付"))`,
+			ActionTarget{Words: []string{"支付"}}},
+		{"no parse", `chromedp.Run(ctx,`,
+			ActionTarget{Scripts: []string{"code which does not parse"}}},
+	}
+	for _, tt := range tests {
+		if got := ActionTargets(tt.code); !reflect.DeepEqual(*got, tt.want) {
+			t.Errorf("%s: ActionTargets = %+v, want %+v", tt.name, *got, tt.want)
+		}
+	}
+}
+
+func TestClassifyRisk(t *testing.T) {
+	tests := []struct {
+		name   string
+		target ActionTarget
+		infos  []*chrome.TargetInfo
+		// Parts of the reasons in order, none for a low risk action
+		want   []string
+	}{
+		{"link", ActionTarget{Refs: []int{3}},
+			[]*chrome.TargetInfo{{Ref: 3, Tag: "a", Text: "Next page"}}, nil},
+		{"delete button", ActionTarget{Refs: []int{4}},
+			[]*chrome.TargetInfo{{Ref: 4, Tag: "button", Text: " Delete "}}, []string{"Element [4] says 'Delete'"}},
+		{"password form", ActionTarget{Selectors: []string{"#login"}},
+			[]*chrome.TargetInfo{{Selector: "#login", Tag: "button", FormFields: []string{"user", "password"}}}, []string{"Element '#login' is in a form with password or card fields"}},
+		{"card field", ActionTarget{Refs: []int{5}},
+			[]*chrome.TargetInfo{{Ref: 5, Tag: "input", Type: "text", FormFields: []string{"cc-number"}}}, []string{"password or card fields"}},
+		{"word", ActionTarget{Words: []string{"transfer"}}, nil, []string{"Code mentions 'transfer'"}},
+		{"script", ActionTarget{Scripts: []string{"Evaluate of '.submit('"}}, nil, []string{"Code runs Evaluate of '.submit('"}},
+		{"variable without submit", ActionTarget{Variables: []string{"Click of a target kept in a variable"}}, nil, nil},
+		{"variable with submit", ActionTarget{Submits: true, Variables: []string{"Click of a target kept in a variable"}}, nil,
+			[]string{"Code submits and runs Click of a target kept in a variable"}},
+		{"submit not found", ActionTarget{Submits: true}, nil, []string{"Code submits a form not found on the page"}},
+		{"submit found", ActionTarget{Submits: true, Selectors: []string{"#q"}},
+			[]*chrome.TargetInfo{{Selector: "#q", Tag: "input", Type: "search"}}, nil},
+	}
+	for _, tt := range tests {
+		target := tt.target
+		reasons := ClassifyRisk(&target, tt.infos)
+		if len(reasons) != len(tt.want) {
+			t.Errorf("%s: reasons %q, want %q", tt.name, reasons, tt.want)
+			continue
+		}
+		for i, want := range tt.want {
+			if !strings.Contains(reasons[i], want) {
+				t.Errorf("%s: reason %q, want one with %q", tt.name, reasons[i], want)
+			}
+		}
+	}
+}
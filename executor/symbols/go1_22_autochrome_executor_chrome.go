@@ -7,16 +7,45 @@ package symbols
 
 import (
 	"autochrome/executor/chrome"
+	"go/constant"
+	"go/token"
 	"reflect"
 )
 
 func init() {
 	Symbols["autochrome/executor/chrome/chrome"] = map[string]reflect.Value{
 		// function, constant and variable definitions
-		"Delete": reflect.ValueOf(chrome.Delete),
-		"New":    reflect.ValueOf(chrome.New),
+		"ClickRef":       reflect.ValueOf(chrome.ClickRef),
+		"Delete":         reflect.ValueOf(chrome.Delete),
+		"Emit":           reflect.ValueOf(chrome.Emit),
+		"ErrCanceled":    reflect.ValueOf(&chrome.ErrCanceled).Elem(),
+		"ErrTimeout":     reflect.ValueOf(&chrome.ErrTimeout).Elem(),
+		"IsValidTool":    reflect.ValueOf(chrome.IsValidTool),
+		"New":            reflect.ValueOf(chrome.New),
+		"NewBrowser":     reflect.ValueOf(chrome.NewBrowser),
+		"RunTool":        reflect.ValueOf(chrome.RunTool),
+		"Secret":         reflect.ValueOf(chrome.Secret),
+		"SetSecrets":     reflect.ValueOf(chrome.SetSecrets),
+		"ToolClick":      reflect.ValueOf(constant.MakeFromLiteral("\"click\"", token.STRING, 0)),
+		"ToolExtract":    reflect.ValueOf(constant.MakeFromLiteral("\"extract\"", token.STRING, 0)),
+		"ToolNames":      reflect.ValueOf(&chrome.ToolNames).Elem(),
+		"ToolNavigate":   reflect.ValueOf(constant.MakeFromLiteral("\"navigate\"", token.STRING, 0)),
+		"ToolScreenshot": reflect.ValueOf(constant.MakeFromLiteral("\"screenshot\"", token.STRING, 0)),
+		"ToolScroll":     reflect.ValueOf(constant.MakeFromLiteral("\"scroll\"", token.STRING, 0)),
+		"ToolSelect":     reflect.ValueOf(constant.MakeFromLiteral("\"select\"", token.STRING, 0)),
+		"ToolType":       reflect.ValueOf(constant.MakeFromLiteral("\"type\"", token.STRING, 0)),
+		"ToolWait":       reflect.ValueOf(constant.MakeFromLiteral("\"wait\"", token.STRING, 0)),
+		"TypeRef":        reflect.ValueOf(chrome.TypeRef),
 
 		// type definitions
-		"Chrome": reflect.ValueOf((*chrome.Chrome)(nil)),
+		"AXNode":         reflect.ValueOf((*chrome.AXNode)(nil)),
+		"BlockedRequest": reflect.ValueOf((*chrome.BlockedRequest)(nil)),
+		"Browser":        reflect.ValueOf((*chrome.Browser)(nil)),
+		"Chrome":         reflect.ValueOf((*chrome.Chrome)(nil)),
+		"Options":        reflect.ValueOf((*chrome.Options)(nil)),
+		"Tab":            reflect.ValueOf((*chrome.Tab)(nil)),
+		"TargetInfo":     reflect.ValueOf((*chrome.TargetInfo)(nil)),
+		"ToolArgs":       reflect.ValueOf((*chrome.ToolArgs)(nil)),
+		"ToolCall":       reflect.ValueOf((*chrome.ToolCall)(nil)),
 	}
 }
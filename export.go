@@ -0,0 +1,104 @@
+package main
+
+import (
+	"os"
+	"fmt"
+	"bytes"
+	"regexp"
+	"errors"
+	"strings"
+	"text/template"
+	_ "embed"
+	"autochrome/executor"
+)
+
+//go:embed EXPORT_TEMPLATE.tmpl
+var exportStr string
+
+// The chrome package and these methods of VarChrome only live in autochrome
+var exportDeniedPattern = regexp.MustCompile(`\bchrome\.\w+|\bVarChrome\.(Active|ListTabs|OpenTab|SwitchTab|CloseTab|Screenshot|ScreenshotElement)\b`)
+
+type exportData struct {
+	Url     string
+	Imports []string
+	Steps   []SessionStep
+}
+
+var exportFuncs = template.FuncMap{
+	"inc": func(i int) int {
+		return i + 1
+	},
+	"comment": func(str string) string {
+		return strings.ReplaceAll(strings.TrimSpace(str), "\n", "\n\t// ")
+	},
+	"indent": func(str string) string {
+		lines := strings.Split(strings.Trim(str, "\r\n"), "\n")
+		for i, line := range lines {
+			if len(line) > 0 {
+				lines[i] = "\t\t" + line
+			}
+		}
+		return strings.Join(lines, "\n")
+	},
+}
+
+// Write successful code blocks of this session as a standalone Go program
+func (s *Session) ExportSession(path string) error {
+	steps := s.GetSessionSteps()
+	if len(steps) <= 0 {
+		return errors.New("No successful action in this session!")
+	}
+
+	data := exportData{Url: steps[0].Url}
+	seen := map[string]bool{}
+	for i, step := range steps {
+		if hidden := hiddenPattern.FindString(step.Code); len(hidden) > 0 {
+			return fmt.Errorf("Step %d uses %s, whose value is not recorded!", i+1, hidden)
+		}
+		if secretPattern.MatchString(step.Code) {
+			return fmt.Errorf("Step %d uses secrets of the vault, which a standalone program does not have!", i+1)
+		}
+		if refPattern.MatchString(step.Code) {
+			return fmt.Errorf("Step %d uses helpers of the chrome package or element numbers of the live page, which a standalone program does not have!", i+1)
+		}
+		if match := exportDeniedPattern.FindString(step.Code); len(match) > 0 {
+			return fmt.Errorf("Step %d uses '%s' of autochrome, which a standalone program does not have!", i+1, match)
+		}
+		imports, code := executor.SplitImports(step.Code)
+		for _, imp := range imports {
+			imp = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(imp), "import"))
+			if !seen[imp] && !isExportImport(imp) {
+				seen[imp] = true
+				data.Imports = append(data.Imports, imp)
+			}
+		}
+		step.Code = code
+		data.Steps = append(data.Steps, step)
+	}
+
+	tmpl, err := template.New("export").Funcs(exportFuncs).Parse(exportStr)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, data)
+	if err != nil {
+		return err
+	}
+	// Nothing is written unless it compiles
+	err = executor.CheckProgram(buf.String())
+	if err != nil {
+		return fmt.Errorf("Exported program does not compile: %s", err)
+	}
+	return os.WriteFile(path, buf.Bytes(), 0644)
+}
+
+// Imported by the template already
+func isExportImport(imp string) bool {
+	for _, pkg := range []string{"context", "flag", "fmt", "os", "time", "github.com/chromedp/chromedp", "github.com/chromedp/chromedp/kb"} {
+		if imp == `"` + pkg + `"` {
+			return true
+		}
+	}
+	return false
+}
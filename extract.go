@@ -0,0 +1,194 @@
+package main
+
+import (
+	"os"
+	"fmt"
+	"bytes"
+	"errors"
+	"strings"
+	"path/filepath"
+	"encoding/csv"
+	"encoding/json"
+	"github.com/autogorg/autog"
+)
+
+// Told to the model in extract mode
+var extractPrompt *autog.PromptItem = &autog.PromptItem{
+	GetPrompt : func (query string) (role string, prompt string) {
+		return autog.ROLE_SYSTEM, "现在是数据提取模式：请输出Go代码块，从页面中提取用户需要的数据，" +
+			"每一条记录调用一次`chrome.Emit(ctx, value)`输出，value可以是struct或map[string]interface{}，" +
+			"同一次提取的记录要使用相同的字段名。`chrome.Emit`必须使用任务的`ctx`，返回error时直接返回这个error。"
+	},
+}
+
+// Run the instruction in extract mode, rows emitted by the code are written to path
+func (s *Session) RunExtract(llm autog.LLM, embedmodel autog.EmbeddingModel, query string, path string) ([]json.RawMessage, error) {
+	if s.Cfg.ActionProtocol == ActionProtocolTools {
+		// Tools have no chrome.Emit, nothing would be extracted
+		return nil, fmt.Errorf("Extract needs action protocol '%s', not '%s'!", ActionProtocolCode, ActionProtocolTools)
+	}
+
+	// Drop rows left by code outside extract mode
+	_, err := s.Action.Executor.ChromeTakeEmitted()
+	if err != nil {
+		return nil, err
+	}
+
+	s.Agent.Extract = true
+	result := s.RunChromeAgent(llm, embedmodel, query)
+	s.Agent.Extract = false
+
+	rows, err := s.Action.Executor.ChromeTakeEmitted()
+	if err != nil {
+		return nil, err
+	}
+	if !result.Ok {
+		if len(result.Error) <= 0 {
+			return rows, errors.New("No code to extract data!")
+		}
+		return rows, errors.New(result.Error)
+	}
+	if len(path) > 0 {
+		err = WriteRows(path, rows)
+	}
+	return rows, err
+}
+
+// Written as CSV for .csv files, as a JSON array for others
+func WriteRows(path string, rows []json.RawMessage) error {
+	var buf []byte
+	var err error
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		buf, err = rowsCsv(rows)
+	} else {
+		buf, err = json.MarshalIndent(rows, "", "  ")
+	}
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf, 0644)
+}
+
+// Top level keys of a JSON object, in the order of the object
+func rowKeys(row json.RawMessage) []string {
+	dec := json.NewDecoder(bytes.NewReader(row))
+	tok, err := dec.Token()
+	if err != nil || tok != json.Delim('{') {
+		return nil
+	}
+	var keys []string
+	for dec.More() {
+		tok, err = dec.Token()
+		if err != nil {
+			return keys
+		}
+		keys = append(keys, fmt.Sprintf("%v", tok))
+		var value json.RawMessage
+		if dec.Decode(&value) != nil {
+			return keys
+		}
+	}
+	return keys
+}
+
+func cellString(value json.RawMessage) string {
+	var str string
+	if json.Unmarshal(value, &str) == nil {
+		return str
+	}
+	if len(value) <= 0 || string(value) == "null" {
+		return ""
+	}
+	return string(value)
+}
+
+// Columns are the keys of all rows in order of first use, rows that are not objects go to column "value"
+func rowsCsv(rows []json.RawMessage) ([]byte, error) {
+	var columns []string
+	seen := map[string]bool{}
+	for _, row := range rows {
+		keys := rowKeys(row)
+		if keys == nil {
+			keys = []string{"value"}
+		}
+		for _, key := range keys {
+			if !seen[key] {
+				seen[key] = true
+				columns = append(columns, key)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write(columns)
+	for _, row := range rows {
+		var fields map[string]json.RawMessage
+		if json.Unmarshal(row, &fields) != nil {
+			fields = map[string]json.RawMessage{"value": row}
+		}
+		record := make([]string, len(columns))
+		for i, column := range columns {
+			record[i] = cellString(fields[column])
+		}
+		w.Write(record)
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// Extract page after page until there is no next page, or maxPages pages, rows seen before are dropped
+func (s *Session) RunCrawl(llm autog.LLM, embedmodel autog.EmbeddingModel, query string, path string, maxPages int) ([]json.RawMessage, error) {
+	var rows []json.RawMessage
+	seen := map[string]bool{}
+	var err error
+	for page := 1; page <= maxPages; page++ {
+		s.ShowAgentLog(1, fmt.Sprintf("CRAWL: Page %d/%d...\n", page, maxPages))
+		var pageRows []json.RawMessage
+		pageRows, err = s.RunExtract(llm, embedmodel, query, "")
+		fresh := 0
+		for _, row := range pageRows {
+			if !seen[string(row)] {
+				seen[string(row)] = true
+				rows = append(rows, row)
+				fresh++
+			}
+		}
+		if err != nil {
+			break
+		}
+		if fresh <= 0 {
+			s.ShowAgentLog(1, fmt.Sprintf("CRAWL: No new rows, stop.\n"))
+			break
+		}
+		if page >= maxPages {
+			break
+		}
+
+		before, _ := s.Action.Executor.ChromeGetHtml()
+		result := s.RunChromeAgent(llm, embedmodel, crawlNextQuery)
+		if !result.Ran {
+			s.ShowAgentLog(1, fmt.Sprintf("CRAWL: No next page, stop.\n"))
+			break
+		}
+		if !result.Ok {
+			err = fmt.Errorf("Next page failed: %s", result.Error)
+			break
+		}
+		after, _ := s.Action.Executor.ChromeGetHtml()
+		if after == before {
+			s.ShowAgentLog(1, fmt.Sprintf("CRAWL: Page not changed, stop.\n"))
+			break
+		}
+	}
+	if len(path) > 0 && len(rows) > 0 {
+		// Rows of pages before a failure are still saved
+		werr := WriteRows(path, rows)
+		if err == nil {
+			err = werr
+		}
+	}
+	return rows, err
+}
+
+const crawlNextQuery = "翻到下一页，并等待新的内容加载完成。如果页面上没有下一页的按钮或链接，或者已经是最后一页，不要输出代码，只回答：没有下一页。"
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestRowsCsv(t *testing.T) {
+	tests := []struct {
+		name string
+		rows []string
+		want string
+	}{
+		{"objects", []string{`{"name":"a","price":1}`, `{"price":2,"name":"b"}`}, "name,price\na,1\nb,2\n"},
+		{"new column", []string{`{"name":"a"}`, `{"name":"b","url":"/b"}`}, "name,url\na,\nb,/b\n"},
+		{"not objects", []string{`"a"`, `2`}, "value\na\n2\n"},
+		{"mixed", []string{`{"name":"a"}`, `"b"`}, "name,value\na,\n,b\n"},
+		{"null and nested", []string{`{"name":null,"tags":["x","y"]}`}, "name,tags\n,\"[\"\"x\"\",\"\"y\"\"]\"\n"},
+		{"quotes and commas", []string{`{"title":"a, \"b\""}`}, "title\n\"a, \"\"b\"\"\"\n"},
+		{"empty", nil, "\n"},
+	}
+	for _, tt := range tests {
+		var rows []json.RawMessage
+		for _, row := range tt.rows {
+			rows = append(rows, json.RawMessage(row))
+		}
+		got, err := rowsCsv(rows)
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s: rowsCsv = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
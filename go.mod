@@ -8,6 +8,7 @@ require (
 	github.com/chromedp/chromedp v0.9.5
 	github.com/emirpasic/gods v1.18.1
 	github.com/traefik/yaegi v0.16.0
+	golang.org/x/net v0.22.0
 	golang.org/x/term v0.18.0
 )
 
@@ -90,6 +90,10 @@ func GetLLM(cfg *Configs) autog.LLM {
 			fmt.Printf("LLM init ERROR: %s\n", err)
 			os.Exit(0)
 		}
+		if cfg.ActionProtocol == ActionProtocolTools {
+			aLLM = NewToolLLM(aLLM, openaiLLM, ollamaLLM)
+		}
+		aLLM = &SecretLLM{LLM: aLLM, Vault: GetVault(cfg)}
 		aLLMInited = true
 	}
 	
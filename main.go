@@ -5,8 +5,11 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strconv"
 	"strings"
+	"encoding/json"
 	"autochrome/readline"
+	"golang.org/x/term"
 	"github.com/autogorg/autog"
 )
 
@@ -19,40 +22,98 @@ const (
 
 func main() {
 	cfg := GetConfigs()
-	llm := GetLLM(cfg)
-	embedModel := GetEmbeddModel(cfg)
 
-	if len(cfg.URL) <= 0 {
+	if len(cfg.URL) <= 0 && len(cfg.RemoteUrl) <= 0 && len(cfg.Replay) <= 0 && len(cfg.Serve) <= 0 {
 		fmt.Println("URL is empty! -h for help!")
 		return
 	}
 
-	
-	action := GetChromeAction()
+	if len(cfg.Serve) > 0 {
+		err := RunServer(cfg, GetLLM(cfg), GetEmbeddModel(cfg))
+		fmt.Printf("%s\n", Red(fmt.Sprintf("Serve ERROR: %s", err)))
+		os.Exit(1)
+	}
+
+	batch := len(cfg.Tasks) > 0 || len(cfg.TaskFile) > 0
+
+	// Keep stdout for the summary in batch mode
+	var logOut io.Writer = os.Stdout
+	if batch {
+		logOut = os.Stderr
+	}
+
+	session := GetSession()
+	action := session.Action
 	action.ShowLog = func (level int, content string) {
 		if level < 0 {
-			fmt.Printf("%s", Red(content))
+			fmt.Fprintf(logOut, "%s", Red(content))
 		} else if level > 0 {
-			fmt.Printf("%s", BrightBlack(content))
+			fmt.Fprintf(logOut, "%s", BrightBlack(content))
 		} else {
-			fmt.Printf("%s", content)
+			fmt.Fprintf(logOut, "%s", content)
 		}
 	}
 
-	agent := GetChromeAgent()
+	agent := session.Agent
 	agent.ShowLog = action.ShowLog
 	
 
-	openerr := ChromeActionOpenUrl(cfg.URL)
+	openerr := session.ChromeActionOpenUrl(cfg.URL)
 	if openerr != nil {
 		fmt.Printf("Open url error : %s\n", openerr)
 		return
 	}
 
+	if len(cfg.Replay) > 0 {
+		err := session.ReplaySession(cfg.Replay)
+		if err != nil {
+			fmt.Printf("%s\n", Red(fmt.Sprintf("Replay ERROR: %s", err)))
+			os.Exit(1)
+		}
+		return
+	}
+
+	llm := GetLLM(cfg)
+	embedModel := GetEmbeddModel(cfg)
+
+	session.Output.WriteContent = func(stage autog.AgentStage, stream autog.StreamStage, buf *strings.Builder, str string) {
+		if stage == autog.AsWaitResponse && stream == autog.StreamStageStart {
+			fmt.Fprintf(logOut, Yellow("## --- AI ---\n"))
+		} else if stage == autog.AsWaitResponse && stream == autog.StreamStageDelta {
+			fmt.Fprint(logOut, Cyan(str))
+		} else if stage == autog.AsWaitResponse && stream == autog.StreamStageEnd {
+			fmt.Fprintln(logOut)
+		} else if stream == autog.StreamStageError {
+			fmt.Fprintf(logOut, "\n%s\n", Red(str))
+		}
+	}
+
+	if batch {
+		os.Exit(RunBatch(session, llm, embedModel))
+	}
+
 	usage := func() {
 		fmt.Fprintln(os.Stderr, "Available Commands:")
 		fmt.Fprintln(os.Stderr, "  /bye            Exit")
 		fmt.Fprintln(os.Stderr, "  /?, /help       Help for a command")
+		fmt.Fprintln(os.Stderr, "  /html           Show HTML of the active tab")
+		fmt.Fprintln(os.Stderr, "  /last           Show HTML sent to the model last time")
+		fmt.Fprintln(os.Stderr, "  /tabs           List tabs, * is the active one")
+		fmt.Fprintln(os.Stderr, "  /tab N          Switch to tab N")
+		fmt.Fprintln(os.Stderr, "  /newtab URL     Open URL in a new tab")
+		fmt.Fprintln(os.Stderr, "  /close          Close the active tab")
+		fmt.Fprintln(os.Stderr, "  /confirm on|off Ask before running each action")
+		fmt.Fprintln(os.Stderr, "  /secret set NAME")
+		fmt.Fprintln(os.Stderr, "                  Save a secret for chrome.Secret(\"NAME\"), the value is not shown, 6 characters at least")
+		fmt.Fprintln(os.Stderr, "  /secret list    List names of the secrets")
+		fmt.Fprintln(os.Stderr, "  /replay FILE    Run the code blocks recorded in a session.jsonl")
+		fmt.Fprintln(os.Stderr, "  /export FILE    Save this session as a standalone Go program")
+		fmt.Fprintln(os.Stderr, "  /extract FILE INSTRUCTION")
+		fmt.Fprintln(os.Stderr, "                  Extract data of the page into FILE (.csv or .json)")
+		fmt.Fprintln(os.Stderr, "  /crawl FILE INSTRUCTION")
+		fmt.Fprintln(os.Stderr, "                  Extract data of every page, following the next page")
+		fmt.Fprintln(os.Stderr, "  /screenshot [PATH] [SELECTOR]")
+		fmt.Fprintln(os.Stderr, "                  Save screenshot of the page or an element")
 		fmt.Fprintln(os.Stderr, "")
 		fmt.Fprintln(os.Stderr, "Use \"\"\" to begin a multi-line message.")
 		fmt.Fprintln(os.Stderr, "")
@@ -69,24 +130,15 @@ func main() {
 		return
 	}
 
+	action.Confirm = ConfirmInTerminal(scanner)
+	action.Approve = ApproveInTerminal(scanner)
+
 	fmt.Print(readline.StartBracketedPaste)
 	defer fmt.Printf(readline.EndBracketedPaste)
 
 	var sb strings.Builder
 	var multiline MultilineState
 
-	output.WriteContent = func(stage autog.AgentStage, stream autog.StreamStage, buf *strings.Builder, str string) {
-		if stage == autog.AsWaitResponse && stream == autog.StreamStageStart {
-			fmt.Printf(Yellow("## --- AI ---\n"))
-		} else if stage == autog.AsWaitResponse && stream == autog.StreamStageDelta {
-			fmt.Print(Cyan(str))
-		} else if stage == autog.AsWaitResponse && stream == autog.StreamStageEnd {
-			fmt.Println()
-		} else if stream == autog.StreamStageError {
-			fmt.Printf("\n%s\n", Red(str))
-		}
-	}
-
 	for {
 		line, err := scanner.Readline()
 		switch {
@@ -136,10 +188,134 @@ func main() {
 		case strings.HasPrefix(line, "/exit"), strings.HasPrefix(line, "/bye"):
 			return
 		case strings.HasPrefix(line, "/html"):
-			fmt.Printf("%s\n", BrightBlack(GetHtmlContext()))
+			fmt.Printf("%s\n", BrightBlack(session.GetHtmlContext()))
 			continue
 		case strings.HasPrefix(line, "/last"):
-			fmt.Printf("%s\n", BrightBlack(GetLastHtmlContext()))
+			fmt.Printf("%s\n", BrightBlack(session.GetLastHtmlContext()))
+			continue
+		case strings.HasPrefix(line, "/tabs"):
+			fmt.Printf("%s", session.ChromeActionTabs())
+			continue
+		case strings.HasPrefix(line, "/tab "):
+			index, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "/tab ")))
+			if err != nil {
+				fmt.Printf("%s\n", Red("Usage: /tab N"))
+				continue
+			}
+			if err = session.ChromeActionSwitchTab(index); err != nil {
+				fmt.Printf("%s\n", Red(fmt.Sprintf("Switch tab ERROR: %s", err)))
+			}
+			continue
+		case strings.HasPrefix(line, "/newtab"):
+			url := strings.TrimSpace(strings.TrimPrefix(line, "/newtab"))
+			if err := session.ChromeActionNewTab(url); err != nil {
+				fmt.Printf("%s\n", Red(fmt.Sprintf("New tab ERROR: %s", err)))
+			}
+			continue
+		case strings.HasPrefix(line, "/screenshot"):
+			args := strings.Fields(strings.TrimPrefix(line, "/screenshot"))
+			path, selector := "", ""
+			if len(args) > 0 {
+				path = args[0]
+			}
+			if len(args) > 1 {
+				selector = strings.Join(args[1:], " ")
+			}
+			path, err := session.ChromeActionScreenshot(path, selector)
+			if err != nil {
+				fmt.Printf("%s\n", Red(fmt.Sprintf("Screenshot ERROR: %s", err)))
+			} else {
+				fmt.Printf("%s\n", BrightBlack(fmt.Sprintf("Screenshot saved to %s", path)))
+			}
+			continue
+		case strings.HasPrefix(line, "/replay"):
+			path := strings.TrimSpace(strings.TrimPrefix(line, "/replay"))
+			if len(path) <= 0 {
+				fmt.Printf("%s\n", Red("Usage: /replay FILE"))
+				continue
+			}
+			if err := session.ReplaySession(path); err != nil {
+				fmt.Printf("%s\n", Red(fmt.Sprintf("Replay ERROR: %s", err)))
+			}
+			continue
+		case strings.HasPrefix(line, "/export"):
+			path := strings.TrimSpace(strings.TrimPrefix(line, "/export"))
+			if len(path) <= 0 {
+				fmt.Printf("%s\n", Red("Usage: /export FILE"))
+				continue
+			}
+			if err := session.ExportSession(path); err != nil {
+				fmt.Printf("%s\n", Red(fmt.Sprintf("Export ERROR: %s", err)))
+			} else {
+				fmt.Printf("%s\n", BrightBlack(fmt.Sprintf("Exported to %s", path)))
+			}
+			continue
+		case strings.HasPrefix(line, "/extract"), strings.HasPrefix(line, "/crawl"):
+			crawl := strings.HasPrefix(line, "/crawl")
+			args := strings.Fields(strings.TrimPrefix(strings.TrimPrefix(line, "/extract"), "/crawl"))
+			if len(args) < 2 {
+				fmt.Printf("%s\n", Red("Usage: /extract FILE INSTRUCTION, /crawl FILE INSTRUCTION"))
+				continue
+			}
+			path, query := args[0], strings.Join(args[1:], " ")
+			fmt.Printf(Green("## ---USER---\n"))
+			fmt.Printf("%s\n", BrightWhite(query))
+			var rows []json.RawMessage
+			if crawl {
+				rows, err = session.RunCrawl(llm, embedModel, query, path, cfg.MaxPages)
+			} else {
+				rows, err = session.RunExtract(llm, embedModel, query, path)
+			}
+			for _, row := range rows {
+				fmt.Printf("%s\n", row)
+			}
+			if err != nil {
+				fmt.Printf("%s\n", Red(fmt.Sprintf("Extract ERROR: %s", err)))
+			} else {
+				fmt.Printf("%s\n", BrightBlack(fmt.Sprintf("%d rows saved to %s", len(rows), path)))
+			}
+			continue
+		case strings.HasPrefix(line, "/confirm"):
+			switch strings.TrimSpace(strings.TrimPrefix(line, "/confirm")) {
+			case "on":
+				cfg.Confirm = true
+			case "off":
+				cfg.Confirm = false
+			default:
+				fmt.Printf("%s\n", Red("Usage: /confirm on|off"))
+				continue
+			}
+			fmt.Printf("%s\n", BrightBlack(fmt.Sprintf("Confirm: %t", cfg.Confirm)))
+			continue
+		case strings.HasPrefix(line, "/secret"):
+			args := strings.Fields(strings.TrimPrefix(line, "/secret"))
+			if len(args) == 1 && args[0] == "list" {
+				for _, name := range GetVault(cfg).Names() {
+					fmt.Printf("%s\n", name)
+				}
+				continue
+			}
+			if len(args) != 2 || args[0] != "set" {
+				fmt.Printf("%s\n", Red("Usage: /secret set NAME, /secret list"))
+				continue
+			}
+			fmt.Printf("Value of %s: ", args[1])
+			value, err := term.ReadPassword(int(os.Stdin.Fd()))
+			fmt.Println()
+			if err != nil {
+				fmt.Printf("%s\n", Red(fmt.Sprintf("Secret ERROR: %s", err)))
+				continue
+			}
+			if err = GetVault(cfg).Set(args[1], string(value)); err != nil {
+				fmt.Printf("%s\n", Red(fmt.Sprintf("Secret ERROR: %s", err)))
+			} else {
+				fmt.Printf("%s\n", BrightBlack(fmt.Sprintf("Secret %s saved to %s", args[1], GetVault(cfg).Path)))
+			}
+			continue
+		case strings.HasPrefix(line, "/close"):
+			if err := session.ChromeActionCloseTab(); err != nil {
+				fmt.Printf("%s\n", Red(fmt.Sprintf("Close tab ERROR: %s", err)))
+			}
 			continue
 		case strings.HasPrefix(line, "/"):
 			sb.WriteString(line)
@@ -150,7 +326,7 @@ func main() {
 		if sb.Len() > 0 && multiline == MultilineNone {
 			fmt.Printf(Green("## ---USER---\n"))
 			fmt.Printf("%s\n", BrightWhite(sb.String()))
-			RunChromeAgent(cfg, llm, embedModel, sb.String())
+			session.RunChromeAgent(llm, embedModel, sb.String())
 			sb.Reset()
 		}
 	}
@@ -41,6 +41,8 @@ type Instance struct {
 	Terminal *Terminal
 	History  *History
 	Pasting  bool
+	// Text to edit by the next Readline, used once
+	Prefill string
 }
 
 func New(prompt Prompt) (*Instance, error) {
@@ -87,6 +89,10 @@ func (i *Instance) Readline() (string, error) {
 	}()
 
 	buf, _ := NewBuffer(i.Prompt)
+	if i.Prefill != "" {
+		buf.Replace([]rune(i.Prefill))
+		i.Prefill = ""
+	}
 
 	var esc bool
 	var escex bool
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"html"
+	"sync"
+	"regexp"
+	"strconv"
+	"strings"
+	"go/token"
+	"go/scanner"
+)
+
+const (
+	RedactPassword = "password"
+	RedactHidden   = "hidden"
+	RedactEmail    = "email"
+	RedactPhone    = "phone"
+	RedactCard     = "card"
+	RedactToken    = "token"
+)
+
+var RedactRuleNames = []string{RedactPassword, RedactHidden, RedactEmail, RedactPhone, RedactCard, RedactToken}
+
+var (
+	inputTagPattern   = regexp.MustCompile(`(?is)<input\b[^>]*>`)
+	// Attributes start after a space, so data-value and the like do not match
+	inputTypePattern  = regexp.MustCompile(`(?i)[\s/]type\s*=\s*["']?(password|hidden)\b`)
+	inputValuePattern = regexp.MustCompile(`(?is)([\s/]value\s*=\s*)("[^"]*"|'[^']*')`)
+	csrfMetaPattern   = regexp.MustCompile(`(?is)(<meta\b[^>]*[\s/]name\s*=\s*["'][^"']*(?:csrf|xsrf|token)[^"']*["'][^>]*[\s/]content\s*=\s*)("[^"]*"|'[^']*')`)
+)
+
+// Text rules, by rule name
+var redactPatterns = map[string]*regexp.Regexp{
+	RedactEmail : regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`),
+	RedactPhone : regexp.MustCompile(`\+\d{1,3}[\s\-]?\(?\d{1,4}\)?(?:[\s\-]?\d{2,4}){2,3}\b|\b1[3-9]\d{9}\b|\(\d{3}\)\s?\d{3}-\d{4}\b`),
+	RedactCard  : regexp.MustCompile(`\b(?:\d[ \-]?){12,18}\d\b`),
+	RedactToken : regexp.MustCompile(`\beyJ[\w\-]+\.[\w\-]+\.[\w\-]+|\b(?:sk|pk|rk|ghp|gho|xox[abp])[_\-][A-Za-z0-9_\-]{16,}|\bAKIA[0-9A-Z]{16}\b|\b[A-Fa-f0-9]{32,}\b`),
+}
+
+func IsValidRedactRule(name string) bool {
+	for _, rule := range RedactRuleNames {
+		if rule == name {
+			return true
+		}
+	}
+	return false
+}
+
+var placeholderPattern = regexp.MustCompile(`\[\[REDACTED_[A-Z0-9_]+\]\]`)
+
+// Placeholders and masked secrets of recorded steps
+var hiddenPattern = regexp.MustCompile(`\[\[REDACTED_[A-Z0-9_]+\]\]|\*\*\*[A-Za-z0-9_]+\*\*\*`)
+
+// Values of the page replaced by placeholders before the model sees them, code gets the values back
+type Redactor struct {
+	Rules    []string
+	Patterns []*regexp.Regexp
+	values   map[string]string
+	holders  map[string]string
+	counts   map[string]int
+	mutex    sync.Mutex
+}
+
+func NewRedactor(rules []string, patterns []string) (*Redactor, error) {
+	r := &Redactor{Rules: rules, values: map[string]string{}, holders: map[string]string{}, counts: map[string]int{}}
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("Redact pattern '%s' ERROR: %s", pattern, err)
+		}
+		r.Patterns = append(r.Patterns, re)
+	}
+	return r, nil
+}
+
+func (r *Redactor) hasRule(rule string) bool {
+	for _, name := range r.Rules {
+		if name == rule {
+			return true
+		}
+	}
+	return false
+}
+
+// Same value, same placeholder
+func (r *Redactor) placeholder(kind string, value string) string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if holder, ok := r.holders[value]; ok {
+		return holder
+	}
+	r.counts[kind]++
+	holder := fmt.Sprintf("[[REDACTED_%s_%d]]", strings.ToUpper(kind), r.counts[kind])
+	r.holders[value] = holder
+	r.values[holder] = value
+	return holder
+}
+
+func luhn(number string) bool {
+	sum := 0
+	double := false
+	for i := len(number) - 1; i >= 0; i-- {
+		d := int(number[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// Text rules and user patterns, for any text sent to the model
+func (r *Redactor) Redact(text string) string {
+	for _, rule := range RedactRuleNames {
+		re, ok := redactPatterns[rule]
+		if !ok || !r.hasRule(rule) {
+			continue
+		}
+		text = re.ReplaceAllStringFunc(text, func(value string) string {
+			if rule == RedactCard && !luhn(strings.NewReplacer(" ", "", "-", "").Replace(value)) {
+				return value
+			}
+			return r.placeholder(rule, value)
+		})
+	}
+	for _, re := range r.Patterns {
+		text = re.ReplaceAllStringFunc(text, func(value string) string {
+			return r.placeholder("custom", value)
+		})
+	}
+	return text
+}
+
+func (r *Redactor) redactQuoted(kind string, quoted string) string {
+	value := quoted[1:len(quoted)-1]
+	if len(value) <= 0 {
+		return quoted
+	}
+	return quoted[:1] + r.placeholder(kind, value) + quoted[len(quoted)-1:]
+}
+
+// Values of password and hidden inputs and csrf metas, then the text rules
+func (r *Redactor) RedactHtml(html string) string {
+	html = inputTagPattern.ReplaceAllStringFunc(html, func(tag string) string {
+		match := inputTypePattern.FindStringSubmatch(tag)
+		if match == nil || !r.hasRule(strings.ToLower(match[1])) {
+			return tag
+		}
+		kind := strings.ToLower(match[1])
+		return inputValuePattern.ReplaceAllStringFunc(tag, func(attr string) string {
+			parts := inputValuePattern.FindStringSubmatch(attr)
+			return parts[1] + r.redactQuoted(kind, parts[2])
+		})
+	})
+	if r.hasRule(RedactHidden) || r.hasRule(RedactToken) {
+		html = csrfMetaPattern.ReplaceAllStringFunc(html, func(meta string) string {
+			parts := csrfMetaPattern.FindStringSubmatch(meta)
+			return parts[1] + r.redactQuoted(RedactToken, parts[2])
+		})
+	}
+	return r.Redact(html)
+}
+
+// Placeholders replaced by the values they stand for, entities of the HTML decoded, e.g. arguments of tool calls
+func (r *Redactor) Restore(str string) string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return placeholderPattern.ReplaceAllStringFunc(str, func(holder string) string {
+		if value, ok := r.values[holder]; ok {
+			return html.UnescapeString(value)
+		}
+		return holder
+	})
+}
+
+// Placeholders in the string literals of code restored, the literals quoted again so any value compiles
+func (r *Redactor) RestoreCode(code string) string {
+	if !placeholderPattern.MatchString(code) {
+		return code
+	}
+	fset := token.NewFileSet()
+	file := fset.AddFile("", fset.Base(), len(code))
+	var sc scanner.Scanner
+	sc.Init(file, []byte(code), nil, 0)
+
+	var sb strings.Builder
+	last := 0
+	for {
+		pos, tok, lit := sc.Scan()
+		if tok == token.EOF {
+			break
+		}
+		if tok != token.STRING || !placeholderPattern.MatchString(lit) {
+			continue
+		}
+		str, err := strconv.Unquote(lit)
+		if err != nil {
+			continue
+		}
+		offset := file.Offset(pos)
+		end := offset + len(lit)
+		if lit[0] == '`' {
+			// Carriage returns are dropped from the literal of a raw string
+			end = offset + 1 + strings.IndexByte(code[offset+1:], '`') + 1
+		}
+		sb.WriteString(code[last:offset])
+		sb.WriteString(strconv.Quote(r.Restore(str)))
+		last = end
+	}
+	sb.WriteString(code[last:])
+	return sb.String()
+}
+
+// Values put back by Restore replaced by their placeholders again, e.g. in errors of restored code
+func (r *Redactor) Hide(text string) string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	var values []string
+	holders := map[string]string{}
+	for holder, value := range r.values {
+		for _, v := range []string{value, html.UnescapeString(value)} {
+			if _, ok := holders[v]; !ok {
+				values = append(values, v)
+			}
+			holders[v] = holder
+		}
+	}
+	// Longest first, so a value inside another is not left
+	sort.Slice(values, func(i, j int) bool {
+		return len(values[i]) > len(values[j])
+	})
+	var pairs []string
+	for _, value := range values {
+		pairs = append(pairs, value, holders[value])
+	}
+	return strings.NewReplacer(pairs...).Replace(text)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRedactRestore(t *testing.T) {
+	r, err := NewRedactor(RedactRuleNames, []string{`ID-\d+`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		text   string
+		hidden string
+	}{
+		{"mail alice@example.com now", "alice@example.com"},
+		{"call +86 138 0013 8000", "+86 138 0013 8000"},
+		{"phone 13800138000", "13800138000"},
+		{"card 4111 1111 1111 1111", "4111 1111 1111 1111"},
+		{"key sk-abcdefghijklmnopqrstuvwxyz", "sk-abcdefghijklmnopqrstuvwxyz"},
+		{"order ID-42", "ID-42"},
+	}
+	for _, tt := range tests {
+		redacted := r.Redact(tt.text)
+		if strings.Contains(redacted, tt.hidden) || !placeholderPattern.MatchString(redacted) {
+			t.Errorf("Redact(%q) = %q", tt.text, redacted)
+		}
+		if restored := r.Restore(redacted); restored != tt.text {
+			t.Errorf("Restore(%q) = %q, want %q", redacted, restored, tt.text)
+		}
+		if hidden := r.Hide(tt.text); hidden != redacted {
+			t.Errorf("Hide(%q) = %q, want %q", tt.text, hidden, redacted)
+		}
+	}
+	// Not a card number
+	if redacted := r.Redact("id 1234 5678 9012 3456"); redacted != "id 1234 5678 9012 3456" {
+		t.Errorf("Redact of a number failing luhn = %q", redacted)
+	}
+}
+
+func TestRedactHtml(t *testing.T) {
+	r, err := NewRedactor(RedactRuleNames, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		html   string
+		hidden string
+	}{
+		{`<input type="password" value="hunter2">`, "hunter2"},
+		{`<input name="csrf" type=hidden value='t0k3n'>`, "t0k3n"},
+		{`<meta name="csrf-token" content="abc123">`, "abc123"},
+	}
+	for _, tt := range tests {
+		if redacted := r.RedactHtml(tt.html); strings.Contains(redacted, tt.hidden) {
+			t.Errorf("RedactHtml(%q) = %q", tt.html, redacted)
+		}
+	}
+	// Attributes ending with type are not the type
+	html := `<input data-type="password" value="visible">`
+	if redacted := r.RedactHtml(html); redacted != html {
+		t.Errorf("RedactHtml(%q) = %q", html, redacted)
+	}
+}
+
+func TestRestoreCode(t *testing.T) {
+	r, err := NewRedactor([]string{RedactHidden}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	redacted := r.RedactHtml(`<input type="hidden" value="a\b&amp;&quot;c`+"`"+`">`)
+	holder := placeholderPattern.FindString(redacted)
+	if len(holder) <= 0 {
+		t.Fatalf("RedactHtml = %q", redacted)
+	}
+	tests := []struct {
+		code string
+		want string
+	}{
+		{`v := "` + holder + `"`, `v := "a\\b&\"c` + "`" + `"`},
+		{"v := `x " + holder + "`", `v := "x a\\b&\"c` + "`" + `"`},
+		{`v := "none"`, `v := "none"`},
+		{`// ` + holder, `// ` + holder},
+	}
+	for _, tt := range tests {
+		if got := r.RestoreCode(tt.code); got != tt.want {
+			t.Errorf("RestoreCode(%q) = %q, want %q", tt.code, got, tt.want)
+		}
+	}
+	if got := r.Hide(`a\b&"c` + "`"); got != holder {
+		t.Errorf("Hide of the decoded value = %q, want %q", got, holder)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"autochrome/executor"
+	"autochrome/executor/chrome"
+)
+
+// Reasons the action is high risk, from the code and the elements it acts on
+func (s *Session) ChromeActionRisk(payload interface{}) []string {
+	target := &executor.ActionTarget{}
+	if calls, ok := payload.([]*chrome.ToolCall); ok {
+		for _, call := range calls {
+			if call.Tool != chrome.ToolClick && call.Tool != chrome.ToolType && call.Tool != chrome.ToolSelect {
+				continue
+			}
+			// Judged on the values the tools will get, not on placeholders
+			selector, text := s.Redactor.Restore(call.Args.Selector), s.Redactor.Restore(call.Args.Text)
+			if word := executor.RiskWord(selector); len(word) > 0 {
+				target.Words = append(target.Words, word)
+			}
+			if call.Tool == chrome.ToolType && strings.ContainsAny(text, "\r\n") {
+				target.Submits = true
+			}
+			if call.Args.Ref > 0 {
+				target.Refs = append(target.Refs, call.Args.Ref)
+			} else if len(selector) > 0 {
+				target.Selectors = append(target.Selectors, selector)
+			}
+		}
+	} else if code, ok := payload.(string); ok {
+		target = executor.ActionTargets(s.Redactor.RestoreCode(code))
+	}
+	var infos []*chrome.TargetInfo
+	if len(target.Refs) > 0 || len(target.Selectors) > 0 {
+		var err error
+		infos, err = s.Action.Executor.ChromeTargetInfos(target.Refs, target.Selectors)
+		if err != nil {
+			s.ShowActionLog(-1, fmt.Sprintf("ACTION: Risk check ERROR -- %s\n", err))
+		}
+	}
+	return executor.ClassifyRisk(target, infos)
+}
+
+// High risk actions run only when the user says yes, there is nobody to ask in batch and serve
+func (s *Session) ChromeActionApprove(content string, payload interface{}) (ok bool, reflection string) {
+	if !s.Cfg.RiskCheck {
+		return true, ""
+	}
+	reasons := s.ChromeActionRisk(payload)
+	if len(reasons) <= 0 {
+		return true, ""
+	}
+	s.ShowActionLog(-1, fmt.Sprintf("ACTION: HIGH RISK -- %s\n", strings.Join(reasons, "; ")))
+	// Asked even with -confirm, a plain 'y' there is too easy for these
+	if s.Action.Approve != nil {
+		lang, block := actionBlock(payload)
+		if s.Action.Approve(reasons, lang, block) {
+			return true, ""
+		}
+	}
+	s.ShowActionLog(-1, fmt.Sprintf("ACTION: REJECTED -- high risk action not approved\n"))
+	s.Action.Result = ActionResult{Ran: true, Error: fmt.Sprintf("High risk action not approved: %s", strings.Join(reasons, "; "))}
+	// Not retried, the agent would only try the same thing again
+	return false, ""
+}
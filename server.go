@@ -0,0 +1,245 @@
+package main
+
+import (
+	"os"
+	"fmt"
+	"net"
+	"sync"
+	"strings"
+	"net/http"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/autogorg/autog"
+)
+
+// Each session has its own browser, instructions of one session run one by one
+type serveSession struct {
+	sync.Mutex
+	Session *Session
+	Url     string
+}
+
+type serveRequest struct {
+	Url         string `json:"url"`
+	Instruction string `json:"instruction"`
+}
+
+type serveResponse struct {
+	Id  string `json:"id"`
+	Url string `json:"url"`
+}
+
+type serveError struct {
+	Error string `json:"error"`
+}
+
+func writeJson(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJson(w, status, serveError{Error: fmt.Sprintf("%s", err)})
+}
+
+// Data is JSON encoded so multi-line content stays in one event
+func writeEvent(w http.ResponseWriter, event string, data interface{}) {
+	buf, err := json.Marshal(data)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, buf)
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Address without host listens on 127.0.0.1 only
+func serveAddr(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || len(host) > 0 {
+		return addr
+	}
+	return net.JoinHostPort("127.0.0.1", port)
+}
+
+func serveToken(cfg *Configs) (string, error) {
+	if len(cfg.ServeToken) > 0 {
+		return cfg.ServeToken, nil
+	}
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(buf)
+	fmt.Fprintf(os.Stderr, "%s", BrightBlack(fmt.Sprintf("SERVE: Token %s\n", token)))
+	return token, nil
+}
+
+// Every request must carry 'Authorization: Bearer <token>'
+func requireToken(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(auth), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, fmt.Errorf("Missing or wrong bearer token!"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func RunServer(cfg *Configs, llm autog.LLM, embedmodel autog.EmbeddingModel) error {
+	token, err := serveToken(cfg)
+	if err != nil {
+		return err
+	}
+
+	var mutex sync.Mutex
+	sessions := map[string]*serveSession{}
+
+	getSession := func(w http.ResponseWriter, r *http.Request) *serveSession {
+		mutex.Lock()
+		defer mutex.Unlock()
+		ss, ok := sessions[r.PathValue("id")]
+		if !ok {
+			writeError(w, http.StatusNotFound, fmt.Errorf("Session '%s' not found!", r.PathValue("id")))
+			return nil
+		}
+		return ss
+	}
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("POST /sessions", func(w http.ResponseWriter, r *http.Request) {
+		var req serveRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		s, err := NewSession(cfg)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		if err = s.ChromeActionOpenUrl(req.Url); err != nil {
+			s.Close()
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		mutex.Lock()
+		sessions[s.Id] = &serveSession{Session: s, Url: req.Url}
+		mutex.Unlock()
+		writeJson(w, http.StatusCreated, serveResponse{Id: s.Id, Url: req.Url})
+	})
+
+	mux.HandleFunc("POST /sessions/{id}/instructions", func(w http.ResponseWriter, r *http.Request) {
+		var req serveRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if len(strings.TrimSpace(req.Instruction)) <= 0 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("Instruction is empty!"))
+			return
+		}
+
+		ss := getSession(w, r)
+		if ss == nil {
+			return
+		}
+		ss.Lock()
+		defer ss.Unlock()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+
+		// Stream to this request while the instruction runs
+		s := ss.Session
+		defer func() {
+			s.Action.ShowLog, s.Agent.ShowLog, s.Output.WriteContent = nil, nil, nil
+		}()
+		s.Action.ShowLog = func (level int, content string) {
+			writeEvent(w, "log", map[string]interface{}{"level": level, "content": content})
+		}
+		s.Agent.ShowLog = s.Action.ShowLog
+		s.Output.WriteContent = func(stage autog.AgentStage, stream autog.StreamStage, buf *strings.Builder, str string) {
+			if stage == autog.AsWaitResponse && stream == autog.StreamStageDelta {
+				writeEvent(w, "llm", str)
+			} else if stream == autog.StreamStageError {
+				writeEvent(w, "error", str)
+			}
+		}
+
+		// A client which left cancels its instruction
+		result := s.RunChromeAgentContext(r.Context(), llm, embedmodel, req.Instruction)
+		writeEvent(w, "result", result)
+	})
+
+	mux.HandleFunc("GET /sessions/{id}/html", func(w http.ResponseWriter, r *http.Request) {
+		ss := getSession(w, r)
+		if ss == nil {
+			return
+		}
+		ss.Lock()
+		defer ss.Unlock()
+
+		html, err := ss.Session.Action.Executor.ChromeGetHtml()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, GetVault(cfg).Mask(html))
+	})
+
+	mux.HandleFunc("GET /sessions/{id}/screenshot", func(w http.ResponseWriter, r *http.Request) {
+		ss := getSession(w, r)
+		if ss == nil {
+			return
+		}
+		ss.Lock()
+		defer ss.Unlock()
+
+		file, err := os.CreateTemp("", "autochrome-*.png")
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		file.Close()
+		defer os.Remove(file.Name())
+
+		_, err = ss.Session.ChromeActionScreenshot(file.Name(), r.URL.Query().Get("selector"))
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		http.ServeFile(w, r, file.Name())
+	})
+
+	mux.HandleFunc("DELETE /sessions/{id}", func(w http.ResponseWriter, r *http.Request) {
+		ss := getSession(w, r)
+		if ss == nil {
+			return
+		}
+		mutex.Lock()
+		delete(sessions, ss.Session.Id)
+		mutex.Unlock()
+
+		ss.Lock()
+		defer ss.Unlock()
+		ss.Session.Close()
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	addr := serveAddr(cfg.Serve)
+	fmt.Fprintf(os.Stderr, "%s", BrightBlack(fmt.Sprintf("SERVE: Listening on %s\n", addr)))
+	return http.ListenAndServe(addr, requireToken(token, mux))
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"os"
+	"fmt"
+	"time"
+	"bufio"
+	"errors"
+	"strings"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"path/filepath"
+	"github.com/autogorg/autog"
+)
+
+type SessionStep struct {
+	Time  string `json:"time"`
+	Query string `json:"query"`
+	Url   string `json:"url"`
+	Code  string `json:"code"`
+}
+
+// Everything one browser session owns, sessions do not share state and can run concurrently
+type Session struct {
+	Id     string
+	Cfg    *Configs
+	Action *ChromeAction
+	Agent  *ChromeAgent
+	Output *autog.Output
+	Redactor *Redactor
+	Dir    string
+	Steps  []SessionStep
+}
+
+var sessionInited bool
+var session *Session
+
+// Session of the prompt, batch and replay modes
+func GetSession() *Session {
+	if !sessionInited {
+		s, err := NewSession(GetConfigs())
+		if err != nil {
+			fmt.Printf("%s\n", err)
+			os.Exit(0)
+		}
+		session = s
+		sessionInited = true
+	}
+	return session
+}
+
+func NewSession(cfg *Configs) (*Session, error) {
+	// Secrets for chrome.Secret, replay does not load the LLM
+	GetVault(cfg)
+	action, err := NewChromeAction(cfg)
+	if err != nil {
+		return nil, err
+	}
+	var rules, patterns []string
+	if cfg.Redact {
+		rules, patterns = cfg.RedactRules, cfg.RedactPatterns
+	}
+	redactor, err := NewRedactor(rules, patterns)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Session{
+		Id     : newSessionId(),
+		Cfg    : cfg,
+		Action : action,
+		Agent  : &ChromeAgent{},
+		Output : &autog.Output{},
+		Redactor : redactor,
+	}
+	action.NeedRun = s.ChromeActionNeedRun
+	action.Check   = s.ChromeActionCheck
+	action.Run     = s.ChromeActionRun
+	return s, nil
+}
+
+func newSessionId() string {
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// Quit the browser of the session
+func (s *Session) Close() error {
+	return s.Action.Executor.ChromeDelete()
+}
+
+// Directory for everything saved by this session, e.g. screenshots
+func (s *Session) GetSessionDir() (string, error) {
+	if len(s.Dir) > 0 {
+		return s.Dir, nil
+	}
+
+	base := s.Cfg.SessionDir
+	if len(base) <= 0 {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		base = filepath.Join(home, ".autochrome", "sessions")
+	}
+	err := os.MkdirAll(base, 0755)
+	if err != nil {
+		return "", err
+	}
+
+	// Sessions started in the same second get a suffix
+	name := time.Now().Format("20060102-150405")
+	dir := filepath.Join(base, name)
+	for i := 1; ; i++ {
+		err = os.Mkdir(dir, 0755)
+		if err == nil {
+			break
+		}
+		if !os.IsExist(err) {
+			return "", err
+		}
+		dir = filepath.Join(base, fmt.Sprintf("%s-%d", name, i))
+	}
+	s.Dir = dir
+	if s.Action != nil {
+		// Screenshots of generated code and tools stay in it
+		s.Action.Executor.ChromeSetSaveDir(dir)
+	}
+	return s.Dir, nil
+}
+
+func (s *Session) GetSessionSteps() []SessionStep {
+	return s.Steps
+}
+
+// Append a successful code block to session.jsonl of the session directory
+func (s *Session) RecordSessionStep(query string, url string, code string) error {
+	step := SessionStep{
+		Time  : time.Now().Format(time.RFC3339),
+		Query : GetVault(s.Cfg).Mask(query),
+		Url   : url,
+		// Values of the page are placeholders already, values the model copied from the query are kept for replay
+		Code  : GetVault(s.Cfg).Mask(code),
+	}
+	s.Steps = append(s.Steps, step)
+
+	dir, err := s.GetSessionDir()
+	if err != nil {
+		return err
+	}
+	line, err := json.Marshal(step)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(filepath.Join(dir, "session.jsonl"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.Write(append(line, '\n'))
+	return err
+}
+
+func LoadSessionSteps(path string) ([]SessionStep, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var steps []SessionStep
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) <= 0 {
+			continue
+		}
+		var step SessionStep
+		err = json.Unmarshal([]byte(line), &step)
+		if err != nil {
+			return nil, err
+		}
+		steps = append(steps, step)
+	}
+	return steps, scanner.Err()
+}
+
+// Run recorded code blocks again without the LLM, stop at the first failure
+func (s *Session) ReplaySession(path string) error {
+	steps, err := LoadSessionSteps(path)
+	if err != nil {
+		return err
+	}
+	if len(steps) <= 0 {
+		return errors.New("Session is empty!")
+	}
+
+	url, _ := s.Action.Executor.ChromeGetUrl()
+	if len(steps[0].Url) > 0 && url != steps[0].Url {
+		err = s.Action.Executor.ChromeSetUrl(steps[0].Url)
+		if err != nil {
+			return err
+		}
+		err = s.Action.Executor.ChromeNavigateAndWaitReady()
+		if err != nil {
+			return err
+		}
+	}
+
+	for i, step := range steps {
+		s.ShowActionLog(1, fmt.Sprintf("REPLAY: (%d/%d) %s\n", i+1, len(steps), step.Query))
+		violations := s.Action.Policy.Check(step.Code)
+		if len(violations) > 0 {
+			return fmt.Errorf("Step %d rejected: %s", i+1, strings.Join(violations, " "))
+		}
+		if hidden := hiddenPattern.FindString(step.Code); len(hidden) > 0 {
+			return fmt.Errorf("Step %d uses %s, whose value is not recorded!", i+1, hidden)
+		}
+		if refPattern.MatchString(step.Code) {
+			// Number the elements of the replayed page again
+			_, err = s.Action.Executor.ChromeElementMap()
+			if err != nil {
+				return fmt.Errorf("Step %d failed: %s", i+1, err)
+			}
+		}
+		if reasons := s.ChromeActionRisk(step.Code); s.Cfg.RiskCheck && len(reasons) > 0 {
+			s.ShowActionLog(-1, fmt.Sprintf("REPLAY: HIGH RISK -- %s\n", strings.Join(reasons, "; ")))
+			if s.Action.Approve == nil || !s.Action.Approve(reasons, "go", step.Code) {
+				return fmt.Errorf("Step %d rejected: high risk action not approved", i+1)
+			}
+		}
+		err = s.Action.Executor.ChromeRunTasks(step.Code)
+		s.Action.Step++
+		if s.Cfg.AutoScreenshot {
+			s.ChromeActionStepScreenshot(s.Action.Step)
+		}
+		if err != nil {
+			return fmt.Errorf("Step %d failed: %s", i+1, err)
+		}
+	}
+	s.ShowActionLog(1, fmt.Sprintf("REPLAY: Success!\n"))
+	return nil
+}
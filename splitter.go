@@ -0,0 +1,314 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+	"golang.org/x/net/html"
+	"github.com/autogorg/autog"
+	"github.com/autogorg/autog/rag"
+)
+
+const (
+	SplitterDom  = "dom"
+	SplitterText = "text"
+)
+
+// Never sent to the model
+var noiseTags = map[string]bool{
+	"script": true, "style": true, "noscript": true, "template": true, "svg": true,
+	"canvas": true, "iframe": true, "object": true, "embed": true,
+	"link": true, "meta": true, "base": true,
+}
+
+var voidTags = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true, "hr": true, "img": true,
+	"input": true, "link": true, "meta": true, "source": true, "track": true, "wbr": true,
+}
+
+var interactiveTags = map[string]bool{
+	"a": true, "button": true, "input": true, "select": true, "textarea": true,
+	"label": true, "option": true, "summary": true, "details": true,
+}
+
+var interactiveRoles = map[string]bool{
+	"button": true, "link": true, "checkbox": true, "radio": true, "tab": true, "switch": true,
+	"menuitem": true, "option": true, "textbox": true, "combobox": true, "searchbox": true,
+}
+
+// Attributes useful to understand or select an element
+var keptAttrs = map[string]bool{
+	"id": true, "class": true, "name": true, "type": true, "value": true, "placeholder": true,
+	"href": true, "role": true, "title": true, "alt": true, "for": true, "action": true, "method": true,
+	"checked": true, "selected": true, "disabled": true, "readonly": true, "contenteditable": true,
+	"tabindex": true, "onclick": true, "data-testid": true, "data-test": true, "data-qa": true,
+}
+
+const maxAttrLen = 100
+
+var spacePattern = regexp.MustCompile(`\s+`)
+var selectorPattern = regexp.MustCompile(`^[A-Za-z_][\w-]*$`)
+
+// Split HTML along the DOM, a chunk is one or more whole subtrees, headed by the selector path of their parent
+type HtmlSplitter struct {
+	ChunkSize int
+}
+
+type htmlChunker struct {
+	size   int
+	sizes  map[*html.Node]int
+	path   string
+	chunks []autog.Chunk
+}
+
+func (s *Session) newSplitter() autog.Splitter {
+	if s.Cfg.Splitter == SplitterText {
+		return &rag.TextSplitter{
+			ChunkSize: s.Cfg.ChunkSize,
+			Overlap: float64(s.Cfg.ChunkOverlap)/float64(100.0),
+			BreakStartChars: []rune { '<' },
+			BreakEndChars:   []rune { '>' },
+		}
+	}
+	return &HtmlSplitter{ChunkSize: s.Cfg.ChunkSize}
+}
+
+func (hs *HtmlSplitter) GetParser() autog.ParserFunction {
+	if hs.ChunkSize <= 0 {
+		hs.ChunkSize = rag.DefaultChunkSize
+	}
+
+	return func (path string, payload interface{}) ([]autog.Chunk, error) {
+		if path == autog.DOCUMENT_PATH_NONE {
+			return nil, fmt.Errorf("Document path is empty!")
+		}
+		content, ok := payload.(string)
+		if !ok {
+			return nil, fmt.Errorf("Payload is not string type!")
+		}
+		doc, err := html.Parse(strings.NewReader(content))
+		if err != nil {
+			return nil, err
+		}
+
+		labels := map[string]string{}
+		collectLabels(doc, labels)
+		cleanNode(doc, labels, hs.ChunkSize)
+
+		chunker := &htmlChunker{size: hs.ChunkSize, sizes: map[*html.Node]int{}, path: path}
+		chunker.measure(doc)
+		chunker.split(doc, nil)
+		return chunker.chunks, nil
+	}
+}
+
+func getAttr(n *html.Node, key string) string {
+	for _, attr := range n.Attr {
+		if attr.Key == key {
+			return attr.Val
+		}
+	}
+	return ""
+}
+
+func nodeText(n *html.Node) string {
+	var sb strings.Builder
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			sb.WriteString(n.Data)
+			sb.WriteString(" ")
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return strings.TrimSpace(spacePattern.ReplaceAllString(sb.String(), " "))
+}
+
+func isInteractive(n *html.Node) bool {
+	if n.Type != html.ElementNode {
+		return false
+	}
+	if interactiveTags[n.Data] || interactiveRoles[getAttr(n, "role")] {
+		return true
+	}
+	for _, attr := range n.Attr {
+		if attr.Key == "onclick" || attr.Key == "contenteditable" || attr.Key == "tabindex" {
+			return true
+		}
+	}
+	return false
+}
+
+// Label text of inputs, by the input id
+func collectLabels(n *html.Node, labels map[string]string) {
+	if n.Type == html.ElementNode && n.Data == "label" {
+		if id := getAttr(n, "for"); len(id) > 0 {
+			labels[id] = nodeText(n)
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		collectLabels(c, labels)
+	}
+}
+
+// Cut to at most size bytes without splitting a UTF-8 character
+func truncate(str string, size int) string {
+	if len(str) <= size {
+		return str
+	}
+	for size > 0 && !utf8.RuneStart(str[size]) {
+		size--
+	}
+	return str[:size] + "..."
+}
+
+// Drop noise and useless attributes, return false if nothing worth keeping is left
+func cleanNode(n *html.Node, labels map[string]string, size int) bool {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		keep := false
+		switch c.Type {
+		case html.ElementNode:
+			keep = !noiseTags[c.Data] && cleanNode(c, labels, size)
+		case html.TextNode:
+			text := truncate(spacePattern.ReplaceAllString(c.Data, " "), size)
+			c.Data = text
+			keep = len(strings.TrimSpace(text)) > 0
+		case html.DoctypeNode:
+			keep = true
+		}
+		if !keep {
+			n.RemoveChild(c)
+		}
+		c = next
+	}
+
+	if n.Type != html.ElementNode {
+		return true
+	}
+
+	var attrs []html.Attribute
+	for _, attr := range n.Attr {
+		if !keptAttrs[attr.Key] && !strings.HasPrefix(attr.Key, "aria-") {
+			continue
+		}
+		attr.Val = truncate(attr.Val, maxAttrLen)
+		attrs = append(attrs, attr)
+	}
+	n.Attr = attrs
+
+	// Keep the label with the input even when they end up in different chunks
+	if label, ok := labels[getAttr(n, "id")]; ok && n.Data != "label" && len(label) > 0 && n.Parent != nil {
+		n.Parent.InsertBefore(&html.Node{Type: html.CommentNode, Data: " label: " + label + " "}, n.NextSibling)
+	}
+
+	if n.FirstChild != nil || isInteractive(n) || n.Data == "img" || n.Data == "body" || n.Data == "html" {
+		return true
+	}
+	return len(getAttr(n, "id")) > 0 || len(getAttr(n, "role")) > 0
+}
+
+func selectorOf(n *html.Node) string {
+	sel := n.Data
+	if id := getAttr(n, "id"); selectorPattern.MatchString(id) {
+		return sel + "#" + id
+	}
+	for _, class := range strings.Fields(getAttr(n, "class")) {
+		if selectorPattern.MatchString(class) {
+			return sel + "." + class
+		}
+	}
+	return sel
+}
+
+func openTag(n *html.Node) string {
+	var sb strings.Builder
+	sb.WriteString("<" + n.Data)
+	for _, attr := range n.Attr {
+		sb.WriteString(fmt.Sprintf(` %s="%s"`, attr.Key, html.EscapeString(attr.Val)))
+	}
+	sb.WriteString(">")
+	return sb.String()
+}
+
+func (hc *htmlChunker) measure(n *html.Node) int {
+	size := 0
+	switch n.Type {
+	case html.TextNode:
+		size = len(html.EscapeString(n.Data))
+	case html.CommentNode:
+		size = len(n.Data) + 7
+	case html.ElementNode:
+		size = len(openTag(n))
+		if !voidTags[n.Data] {
+			size += len(n.Data) + 3
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		size += hc.measure(c)
+	}
+	hc.sizes[n] = size
+	return size
+}
+
+func (hc *htmlChunker) render(sb *strings.Builder, n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		sb.WriteString(html.EscapeString(n.Data))
+		return
+	case html.CommentNode:
+		sb.WriteString("<!--" + n.Data + "-->")
+		return
+	case html.ElementNode:
+		sb.WriteString(openTag(n))
+		if voidTags[n.Data] {
+			return
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		hc.render(sb, c)
+	}
+	if n.Type == html.ElementNode {
+		sb.WriteString("</" + n.Data + ">")
+	}
+}
+
+func (hc *htmlChunker) emit(selectors []string, content string) {
+	if len(strings.TrimSpace(content)) <= 0 {
+		return
+	}
+	query := content
+	if len(selectors) > 0 {
+		content = fmt.Sprintf("<!-- %s -->\n%s", strings.Join(selectors, " > "), content)
+	}
+	hc.chunks = append(hc.chunks, &rag.MemChunk{
+		Index   : len(hc.chunks),
+		Path    : hc.path,
+		Query   : query,
+		Content : content,
+	})
+}
+
+// Children of n go into chunks as whole subtrees, too large ones are split again
+func (hc *htmlChunker) split(n *html.Node, selectors []string) {
+	var sb strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		size := hc.sizes[c]
+		if size > hc.size && c.Type == html.ElementNode && !isInteractive(c) && c.FirstChild != nil {
+			hc.emit(selectors, sb.String())
+			sb.Reset()
+			hc.split(c, append(selectors[:len(selectors):len(selectors)], selectorOf(c)))
+			continue
+		}
+		if sb.Len() > 0 && sb.Len() + size > hc.size {
+			hc.emit(selectors, sb.String())
+			sb.Reset()
+		}
+		hc.render(&sb, c)
+	}
+	hc.emit(selectors, sb.String())
+}
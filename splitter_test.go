@@ -0,0 +1,108 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		str  string
+		size int
+		want string
+	}{
+		{"hello", 10, "hello"},
+		{"hello", 5, "hello"},
+		{"hello world", 5, "hello..."},
+		{"你好世界", 4, "你..."},
+		{"你好世界", 6, "你好..."},
+		{"你好世界", 2, "..."},
+	}
+	for _, tt := range tests {
+		got := truncate(tt.str, tt.size)
+		if got != tt.want || !utf8.ValidString(got) {
+			t.Errorf("truncate(%q, %d) = %q, want %q", tt.str, tt.size, got, tt.want)
+		}
+	}
+}
+
+func splitHtml(t *testing.T, size int, content string) []string {
+	splitter := &HtmlSplitter{ChunkSize: size}
+	chunks, err := splitter.GetParser()("/html", content)
+	if err != nil {
+		t.Fatalf("GetParser: %s", err)
+	}
+	var contents []string
+	for i, chunk := range chunks {
+		if chunk.GetIndex() != i || chunk.GetPath() != "/html" {
+			t.Errorf("Chunk %d: index %d, path %q", i, chunk.GetIndex(), chunk.GetPath())
+		}
+		contents = append(contents, chunk.GetContent())
+	}
+	return contents
+}
+
+func TestHtmlSplitterClean(t *testing.T) {
+	content := `<html><head><script>alert(1)</script><style>p{}</style></head><body>
+		<div style="color:red" data-x="1"><p>  Hello   world  </p></div>
+		<label for="q">Search</label><input id="q" name="q" onfocus="x()">
+		<div></div>
+	</body></html>`
+	chunks := splitHtml(t, 1000, content)
+	if len(chunks) != 1 {
+		t.Fatalf("%d chunks, want 1: %q", len(chunks), chunks)
+	}
+	chunk := chunks[0]
+	for _, gone := range []string{"alert", "p{}", "style=", "data-x", "onfocus", "<div></div>"} {
+		if strings.Contains(chunk, gone) {
+			t.Errorf("Chunk has %q: %s", gone, chunk)
+		}
+	}
+	for _, kept := range []string{"<p> Hello world </p>", `<input id="q" name="q">`, "<!-- label: Search -->"} {
+		if !strings.Contains(chunk, kept) {
+			t.Errorf("Chunk has no %q: %s", kept, chunk)
+		}
+	}
+}
+
+func TestHtmlSplitterSize(t *testing.T) {
+	var sb strings.Builder
+	sb.WriteString(`<html><body><div id="list" class="items">`)
+	for i := 0; i < 50; i++ {
+		sb.WriteString(`<section class="item"><p>Item text of some length</p><a href="/item">Open</a></section>`)
+	}
+	sb.WriteString(`</div></body></html>`)
+	chunks := splitHtml(t, 400, sb.String())
+	if len(chunks) < 2 {
+		t.Fatalf("%d chunks, want the list split", len(chunks))
+	}
+	sections := 0
+	for _, chunk := range chunks {
+		// Headed by the path of the parent, whole subtrees only
+		if !strings.HasPrefix(chunk, "<!-- html > body > div#list -->\n") {
+			t.Errorf("Chunk is not headed by its path: %.80q", chunk)
+		}
+		body := chunk[strings.Index(chunk, "\n")+1:]
+		if len(body) > 400 {
+			t.Errorf("Chunk of %d bytes, want at most 400", len(body))
+		}
+		if strings.Count(body, "<section") != strings.Count(body, "</section>") {
+			t.Errorf("Chunk splits a section: %q", body)
+		}
+		sections += strings.Count(body, "<section")
+	}
+	if sections != 50 {
+		t.Errorf("%d sections in chunks, want 50", sections)
+	}
+}
+
+func TestHtmlSplitterErrors(t *testing.T) {
+	parser := (&HtmlSplitter{}).GetParser()
+	if _, err := parser("", "<html></html>"); err == nil {
+		t.Errorf("Empty path did not fail")
+	}
+	if _, err := parser("/html", 1); err == nil {
+		t.Errorf("Payload which is not a string did not fail")
+	}
+}
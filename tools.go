@@ -0,0 +1,234 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"context"
+	"strings"
+	"net/http"
+	"encoding/json"
+	"autochrome/executor/chrome"
+	"github.com/autogorg/autog"
+	"github.com/autogorg/autog/llm"
+)
+
+const (
+	ActionProtocolCode  = "code"
+	ActionProtocolTools = "tools"
+)
+
+var toolBlockPattern = regexp.MustCompile(`(?s)\x60\x60\x60json\n(.*?)\n\x60\x60\x60`)
+
+type toolFunction struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	Parameters  map[string]interface{} `json:"parameters"`
+}
+
+type toolSpec struct {
+	Type     string       `json:"type"`
+	Function toolFunction `json:"function"`
+}
+
+type toolMessage struct {
+	Role      string `json:"role"`
+	Content   string `json:"content"`
+	ToolCalls []struct {
+		Function struct {
+			Name      string          `json:"name"`
+			// String of JSON from OpenAI, object from Ollama
+			Arguments json.RawMessage `json:"arguments"`
+		} `json:"function"`
+	} `json:"tool_calls,omitempty"`
+}
+
+type toolRequest struct {
+	Model       string              `json:"model"`
+	Messages    []autog.ChatMessage `json:"messages"`
+	Tools       []toolSpec          `json:"tools"`
+	Temperature float32             `json:"temperature"`
+	Stream      bool                `json:"stream"`
+	Options     map[string]float32  `json:"options,omitempty"`
+}
+
+type toolResponse struct {
+	// OpenAI
+	Choices []struct {
+		Message toolMessage `json:"message"`
+	} `json:"choices"`
+	// Ollama
+	Message toolMessage `json:"message"`
+}
+
+func toolParams(required []string, props map[string]string) map[string]interface{} {
+	properties := map[string]interface{}{}
+	for name, desc := range props {
+		typ := "string"
+		if name == "ref" || name == "pixels" {
+			typ = "integer"
+		} else if name == "seconds" {
+			typ = "number"
+		}
+		properties[name] = map[string]string{"type": typ, "description": desc}
+	}
+	return map[string]interface{}{"type": "object", "properties": properties, "required": required}
+}
+
+var toolElement = map[string]string{
+	"ref":      "Number of the element in the element map, preferred",
+	"selector": "CSS selector of the element, if it has no number",
+}
+
+func withElement(props map[string]string) map[string]string {
+	for k, v := range toolElement {
+		props[k] = v
+	}
+	return props
+}
+
+var toolSpecs = []toolSpec{
+	{"function", toolFunction{chrome.ToolNavigate, "Open the url in the current tab", toolParams([]string{"url"}, map[string]string{"url": "Absolute url"})}},
+	{"function", toolFunction{chrome.ToolClick, "Click an element", toolParams(nil, withElement(map[string]string{}))}},
+	{"function", toolFunction{chrome.ToolType, "Replace the text of an input with the text", toolParams([]string{"text"}, withElement(map[string]string{"text": "Text to type"}))}},
+	{"function", toolFunction{chrome.ToolSelect, "Choose an option of a select element", toolParams([]string{"value"}, withElement(map[string]string{"value": "Value or text of the option"}))}},
+	{"function", toolFunction{chrome.ToolScroll, "Scroll the element into view, or scroll the page down by pixels without an element", toolParams(nil, withElement(map[string]string{"pixels": "Pixels to scroll, negative is up, default one screen"}))}},
+	{"function", toolFunction{chrome.ToolWait, "Wait until the element is visible, or wait seconds without an element", toolParams(nil, withElement(map[string]string{"seconds": "Seconds to wait"}))}},
+	{"function", toolFunction{chrome.ToolExtract, "Get the text, or the attribute, of all elements matching the selector", toolParams(nil, withElement(map[string]string{"attribute": "Attribute to get instead of the text"}))}},
+	{"function", toolFunction{chrome.ToolScreenshot, "Save a screenshot of the page, or of the element of the selector", toolParams(nil, map[string]string{"selector": "CSS selector of the element", "path": "File name to save in the session directory, .png or .jpg"})}},
+}
+
+// Told to the model in tools protocol
+var toolPrompt *autog.PromptItem = &autog.PromptItem{
+	GetPrompt : func (query string) (role string, prompt string) {
+		return autog.ROLE_SYSTEM, "请优先调用工具（" + strings.Join(chrome.ToolNames, "、") + "）来操作浏览器，不需要写Go代码。" +
+			"如果不能调用工具，可以输出一个json代码块，内容是工具调用的数组，例如：\n" +
+			"\x60\x60\x60json\n[{\"tool\": \"type\", \"args\": {\"ref\": 7, \"text\": \"hello\"}}, {\"tool\": \"click\", \"args\": {\"ref\": 12}}]\n\x60\x60\x60"
+	},
+}
+
+// LLM asking with function calling, tool calls are turned into a json block of the reply
+type ToolLLM struct {
+	autog.LLM
+	OpenAi *llm.OpenAi
+	Ollama *llm.Ollama
+	client *http.Client
+}
+
+// One of openai and ollama is the LLM asked, sessions of the server share it
+func NewToolLLM(base autog.LLM, openai *llm.OpenAi, ollama *llm.Ollama) *ToolLLM {
+	return &ToolLLM{LLM: base, OpenAi: openai, Ollama: ollama, client: &http.Client{}}
+}
+
+func (t *ToolLLM) sendTools(cxt context.Context, msgs []autog.ChatMessage) (autog.LLMStatus, autog.ChatMessage) {
+	var httpReq *http.Request
+	var err error
+	request := &toolRequest{Messages: msgs, Tools: toolSpecs}
+	if t.OpenAi != nil {
+		request.Model = t.OpenAi.Model
+		request.Temperature = float32(t.OpenAi.Temperature) / float32(100)
+		httpReq, err = t.OpenAi.CreateHttpRequest(cxt, "POST", "/chat/completions", request)
+	} else {
+		request.Model = t.Ollama.Model
+		request.Options = map[string]float32{"temperature": float32(t.Ollama.Temperature) / float32(100)}
+		httpReq, err = t.Ollama.CreateHttpRequest(cxt, "POST", "/api/chat", request)
+	}
+	if err != nil {
+		return autog.LLM_STATUS_BED_REQUEST, autog.ChatMessage{Role:autog.ROLE_ASSISTANT, Content: err.Error()}
+	}
+
+	var httpRsp *http.Response
+	if t.OpenAi != nil {
+		httpRsp, err = t.OpenAi.GetHttpResponse(t.client, httpReq)
+	} else {
+		httpRsp, err = t.Ollama.GetHttpResponse(t.client, httpReq)
+	}
+	if err != nil {
+		return autog.LLM_STATUS_BED_RESPONSE, autog.ChatMessage{Role:autog.ROLE_ASSISTANT, Content: err.Error()}
+	}
+	defer httpRsp.Body.Close()
+
+	var response toolResponse
+	err = json.NewDecoder(httpRsp.Body).Decode(&response)
+	if err != nil {
+		return autog.LLM_STATUS_BED_MESSAGE, autog.ChatMessage{Role:autog.ROLE_ASSISTANT, Content: err.Error()}
+	}
+	message := response.Message
+	if len(response.Choices) > 0 {
+		message = response.Choices[0].Message
+	}
+
+	content := message.Content
+	var calls []*chrome.ToolCall
+	for _, tc := range message.ToolCalls {
+		call := &chrome.ToolCall{Tool: tc.Function.Name}
+		args := []byte(tc.Function.Arguments)
+		var str string
+		if json.Unmarshal(args, &str) == nil {
+			args = []byte(str)
+		}
+		if len(args) > 0 {
+			err = json.Unmarshal(args, &call.Args)
+			if err != nil {
+				return autog.LLM_STATUS_BED_MESSAGE, autog.ChatMessage{Role:autog.ROLE_ASSISTANT, Content: fmt.Sprintf("Tool '%s' arguments invalid: %s", call.Tool, err)}
+			}
+		}
+		calls = append(calls, call)
+	}
+	if len(calls) > 0 {
+		buf, _ := json.Marshal(calls)
+		content = strings.TrimSpace(content + "\n\x60\x60\x60json\n" + string(buf) + "\n\x60\x60\x60")
+	}
+	return autog.LLM_STATUS_OK, autog.ChatMessage{Role:autog.ROLE_ASSISTANT, Content: content}
+}
+
+func (t *ToolLLM) SendMessages(cxt context.Context, msgs []autog.ChatMessage) (autog.LLMStatus, autog.ChatMessage) {
+	return t.sendTools(cxt, msgs)
+}
+
+// Tool calls do not stream, the whole reply is one delta
+func (t *ToolLLM) SendMessagesStream(cxt context.Context, msgs []autog.ChatMessage, reader autog.StreamReader) (autog.LLMStatus, autog.ChatMessage) {
+	var contentbuf *strings.Builder
+	if reader != nil {
+		contentbuf = reader.StreamStart()
+	}
+	status, msg := t.sendTools(cxt, msgs)
+	if reader != nil {
+		if status != autog.LLM_STATUS_OK {
+			reader.StreamError(contentbuf, status, msg.Content)
+		} else {
+			contentbuf.WriteString(msg.Content)
+			reader.StreamDelta(contentbuf, msg.Content)
+		}
+		reader.StreamEnd(contentbuf)
+	}
+	return status, msg
+}
+
+// A json block of one tool call or an array of them
+func ParseToolCalls(block string) ([]*chrome.ToolCall, error) {
+	var calls []*chrome.ToolCall
+	block = strings.TrimSpace(block)
+	if strings.HasPrefix(block, "{") {
+		block = "[" + block + "]"
+	}
+	err := json.Unmarshal([]byte(block), &calls)
+	if err != nil {
+		return nil, err
+	}
+	for i, call := range calls {
+		if call == nil || !chrome.IsValidTool(call.Tool) {
+			return nil, fmt.Errorf("Tool %d is not one of %s!", i+1, strings.Join(chrome.ToolNames, ", "))
+		}
+	}
+	return calls, nil
+}
+
+// Same steps as Go code, so tool calls can be recorded and replayed
+func ToolCallsCode(calls []*chrome.ToolCall) string {
+	var sb strings.Builder
+	for _, call := range calls {
+		sb.WriteString(fmt.Sprintf("if _, err := chrome.RunTool(ctx, %#v); err != nil {\n\treturn err\n}\n", call))
+	}
+	sb.WriteString("return nil")
+	return sb.String()
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"os"
+	"io"
+	"fmt"
+	"sort"
+	"sync"
+	"regexp"
+	"context"
+	"strings"
+	"crypto/aes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/cipher"
+	"encoding/json"
+	"encoding/binary"
+	"path/filepath"
+	"autochrome/executor/chrome"
+	"github.com/autogorg/autog"
+	"golang.org/x/term"
+)
+
+// Shorter values are refused, masking them would garble any text they happen to be in
+const MinSecretLen = 6
+
+const (
+	vaultSaltLen    = 16
+	vaultIterations = 600000
+)
+
+// Secrets encrypted with AES-GCM, the key is derived from a passphrase and never stored
+type Vault struct {
+	Path    string
+	Secrets map[string]string
+	salt    []byte
+	key     []byte
+	mutex   sync.Mutex
+}
+
+var secretPattern = regexp.MustCompile(`chrome\.Secret\("([^"]*)"\)`)
+
+var vaultInited bool
+var vault *Vault
+
+func GetVault(cfg *Configs) *Vault {
+	if !vaultInited {
+		vaultInited = true
+		v, err := LoadVault(cfg)
+		if err != nil {
+			fmt.Printf("%s\n", Red(fmt.Sprintf("Vault ERROR: %s", err)))
+			v = &Vault{Secrets: map[string]string{}}
+		}
+		vault = v
+	}
+	return vault
+}
+
+func LoadVault(cfg *Configs) (*Vault, error) {
+	path := cfg.VaultPath
+	if len(path) <= 0 {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		path = filepath.Join(home, ".autochrome", "secrets.vault")
+	}
+	v := &Vault{Path: path, Secrets: map[string]string{}}
+	data, err := os.ReadFile(v.Path)
+	if os.IsNotExist(err) {
+		return v, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Salt, nonce, then the sealed secrets
+	if len(data) < vaultSaltLen {
+		return nil, fmt.Errorf("Vault '%s' is broken!", v.Path)
+	}
+	v.salt = data[:vaultSaltLen]
+	gcm, err := v.cipher()
+	if err != nil {
+		return nil, err
+	}
+	data = data[vaultSaltLen:]
+	if len(data) < gcm.NonceSize() {
+		return nil, fmt.Errorf("Vault '%s' is broken!", v.Path)
+	}
+	plain, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, fmt.Errorf("Vault '%s' can not be decrypted, wrong passphrase?", v.Path)
+	}
+	err = json.Unmarshal(plain, &v.Secrets)
+	if err != nil {
+		return nil, err
+	}
+	chrome.SetSecrets(v.Secrets)
+	return v, nil
+}
+
+// PBKDF2 with HMAC-SHA256, RFC 8018
+func pbkdf2Key(password []byte, salt []byte, iterations int, size int) []byte {
+	prf := hmac.New(sha256.New, password)
+	var key []byte
+	for block := uint32(1); len(key) < size; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.Write(prf, binary.BigEndian, block)
+		u := prf.Sum(nil)
+		t := append([]byte{}, u...)
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		key = append(key, t...)
+	}
+	return key[:size]
+}
+
+// From VAULT_PASSPHRASE, or asked in the terminal
+func vaultPassphrase(path string) ([]byte, error) {
+	if passphrase := os.Getenv("VAULT_PASSPHRASE"); len(passphrase) > 0 {
+		return []byte(passphrase), nil
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return nil, fmt.Errorf("Vault '%s' needs VAULT_PASSPHRASE without a terminal!", path)
+	}
+	fmt.Printf("Passphrase of vault %s: ", path)
+	passphrase, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Println()
+	if err != nil {
+		return nil, err
+	}
+	if len(passphrase) <= 0 {
+		return nil, fmt.Errorf("Passphrase of vault '%s' is empty!", path)
+	}
+	return passphrase, nil
+}
+
+// The salt is created with the first secret, the passphrase is asked once
+func (v *Vault) cipher() (cipher.AEAD, error) {
+	if len(v.key) <= 0 {
+		if len(v.salt) <= 0 {
+			v.salt = make([]byte, vaultSaltLen)
+			_, err := io.ReadFull(rand.Reader, v.salt)
+			if err != nil {
+				return nil, err
+			}
+		}
+		passphrase, err := vaultPassphrase(v.Path)
+		if err != nil {
+			return nil, err
+		}
+		v.key = pbkdf2Key(passphrase, v.salt, vaultIterations, 32)
+	}
+	block, err := aes.NewCipher(v.key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (v *Vault) save() error {
+	if len(v.Path) <= 0 {
+		return fmt.Errorf("Vault is not loaded!")
+	}
+	plain, err := json.Marshal(v.Secrets)
+	if err != nil {
+		return err
+	}
+	gcm, err := v.cipher()
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	_, err = io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(v.Path), 0700)
+	if err != nil {
+		return err
+	}
+	data := append(append([]byte{}, v.salt...), gcm.Seal(nonce, nonce, plain, nil)...)
+	return os.WriteFile(v.Path, data, 0600)
+}
+
+func (v *Vault) Set(name string, value string) error {
+	if len(value) < MinSecretLen {
+		return fmt.Errorf("Secret %s is shorter than %d characters!", name, MinSecretLen)
+	}
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	v.Secrets[name] = value
+	chrome.SetSecrets(v.Secrets)
+	return v.save()
+}
+
+func (v *Vault) Names() []string {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	var names []string
+	for name := range v.Secrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Values of secrets replaced by ***NAME***, longest first so a value inside another is not left
+func (v *Vault) Mask(str string) string {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	if len(v.Secrets) <= 0 {
+		return str
+	}
+	var names []string
+	for name, value := range v.Secrets {
+		// Short values of older vaults too, they must not reach the LLM either
+		if len(value) > 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return len(v.Secrets[names[i]]) > len(v.Secrets[names[j]])
+	})
+	for _, name := range names {
+		str = strings.ReplaceAll(str, v.Secrets[name], fmt.Sprintf("***%s***", name))
+	}
+	return str
+}
+
+// Secrets used by the code but not in the vault
+func (v *Vault) Missing(code string) []string {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	var missing []string
+	for _, match := range secretPattern.FindAllStringSubmatch(code, -1) {
+		if _, ok := v.Secrets[match[1]]; !ok {
+			missing = append(missing, match[1])
+		}
+	}
+	return missing
+}
+
+// LLM never given the values of secrets, whatever the messages have
+type SecretLLM struct {
+	autog.LLM
+	Vault *Vault
+}
+
+func (l *SecretLLM) mask(msgs []autog.ChatMessage) []autog.ChatMessage {
+	masked := make([]autog.ChatMessage, len(msgs))
+	for i, msg := range msgs {
+		masked[i] = autog.ChatMessage{Role: msg.Role, Content: l.Vault.Mask(msg.Content)}
+	}
+	return masked
+}
+
+func (l *SecretLLM) SendMessages(cxt context.Context, msgs []autog.ChatMessage) (autog.LLMStatus, autog.ChatMessage) {
+	return l.LLM.SendMessages(cxt, l.mask(msgs))
+}
+
+func (l *SecretLLM) SendMessagesStream(cxt context.Context, msgs []autog.ChatMessage, reader autog.StreamReader) (autog.LLMStatus, autog.ChatMessage) {
+	return l.LLM.SendMessagesStream(cxt, l.mask(msgs), reader)
+}
+
+func (l *SecretLLM) SendMessagesByWeakModel(cxt context.Context, msgs []autog.ChatMessage) (autog.LLMStatus, autog.ChatMessage) {
+	return l.LLM.SendMessagesByWeakModel(cxt, l.mask(msgs))
+}
+
+func (l *SecretLLM) SendMessagesStreamByWeakModel(cxt context.Context, msgs []autog.ChatMessage, reader autog.StreamReader) (autog.LLMStatus, autog.ChatMessage) {
+	return l.LLM.SendMessagesStreamByWeakModel(cxt, l.mask(msgs), reader)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestPbkdf2Key(t *testing.T) {
+	// PBKDF2-HMAC-SHA256 of RFC 7914 section 11, and of the RFC 6070 inputs
+	tests := []struct {
+		password   string
+		salt       string
+		iterations int
+		size       int
+		want       string
+	}{
+		{"passwd", "salt", 1, 64, "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783"},
+		{"Password", "NaCl", 80000, 64, "4ddcd8f60b98be21830cee5ef22701f9641a4418d04c0414aeff08876b34ab56a1d425a1225833549adb841b51c9b3176a272bdebba1d078478f62b397f33c8d"},
+		{"password", "salt", 1, 32, "120fb6cffcf8b32c43e7225256c4f837a86548c92ccc35480805987cb70be17b"},
+		{"password", "salt", 4096, 32, "c5e478d59288c841aa530db6845c4c8d962893a001ce4e11a4963873aa98134a"},
+	}
+	for _, tt := range tests {
+		got := hex.EncodeToString(pbkdf2Key([]byte(tt.password), []byte(tt.salt), tt.iterations, tt.size))
+		if got != tt.want {
+			t.Errorf("pbkdf2Key(%q, %q, %d) = %s, want %s", tt.password, tt.salt, tt.iterations, got, tt.want)
+		}
+	}
+}
+
+func TestVaultMask(t *testing.T) {
+	v := &Vault{Secrets: map[string]string{
+		"PIN":      "1234",
+		"PASSWORD": "hunter2hunter2",
+		"USER":     "hunter2",
+		"EMPTY":    "",
+	}}
+	tests := []struct {
+		str  string
+		want string
+	}{
+		{"pin 1234", "pin ***PIN***"},
+		{"typed hunter2hunter2", "typed ***PASSWORD***"},
+		{"user hunter2", "user ***USER***"},
+		{"nothing here", "nothing here"},
+	}
+	for _, tt := range tests {
+		if got := v.Mask(tt.str); got != tt.want {
+			t.Errorf("Mask(%q) = %q, want %q", tt.str, got, tt.want)
+		}
+	}
+}
+
+func TestVaultSetShort(t *testing.T) {
+	v := &Vault{Path: t.TempDir() + "/secrets.vault", Secrets: map[string]string{}}
+	if err := v.Set("PIN", "1234"); err == nil {
+		t.Errorf("Set of a short secret did not fail")
+	}
+	if _, ok := v.Secrets["PIN"]; ok {
+		t.Errorf("Short secret is stored")
+	}
+}